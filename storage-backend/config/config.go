@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -12,14 +13,96 @@ type Config struct {
 	UploadTmpDir   string
 	VideosDir      string
 	MaterialsDir   string
+	QuarantineDir  string
+	TrashDir       string
+	KeysDir        string // HLS encryption keys; must not be served by nginx
 	ChunkSize      int64
 	MaxConcurrent  int
 	MergeWorkers   int
+	PackageWorkers int // Preview images and streaming ladders, generated after the ready webhook
 	MainBackendURL string
 	PublicBaseURL  string
 	FFProbePath    string
+	FFmpegPath     string
 	JWTSecret      string
 	InternalAPIKey string // API key for internal backend-to-backend communication
+	IDPattern      string // Regexp for lesson IDs, empty accepts UUIDs only; video and material IDs are always UUIDs
+
+	// Upload processing
+	ValidateVideos     bool     // Reject uploaded videos that are not browser-playable H.264 MP4
+	AllowedVideoTypes  []string // Content types accepted by POST /uploads/videos; non-MP4 uploads are converted
+	TranscodePreset    string   // x264 preset used when a video has to be re-encoded
+	TranscodeCRF       int      // x264 constant rate factor (lower is better quality, larger files)
+	Faststart          bool     // Move the moov box of uploaded MP4s in front of the media data
+	VideoVersionsKeep  int      // Versions of a video kept on disk, current included; older ones go to the trash (0 keeps all)
+	MediaProbeTimeout  int      // Seconds an ffprobe run, decode check or frame grab may take (0 = no limit)
+	MediaEncodeTimeout int      // Seconds a conversion, streaming ladder or sprite sheet may take (0 = no limit)
+
+	// HLS packaging
+	HLSEnabled        bool   // Encode an adaptive bitrate HLS ladder after each video upload
+	HLSRenditions     []int  // Rendition sizes (short side, e.g. 720 for 720p); sizes above the source are skipped
+	HLSSegmentSeconds int    // Target segment duration
+	HLSEncryption     bool   // Encrypt HLS segments with a per-version AES-128 key
+	HLSKeyBaseURL     string // Base URL of the key endpoint written into playlists
+	DASHEnabled       bool   // Also write a DASH manifest; renditions are then encoded once as shared CMAF segments. Not allowed with HLSEncryption
+
+	// Preview images
+	PreviewImages         bool    // Extract a poster, thumbnails and a scrubbing sprite sheet after each video upload
+	PosterOffsetSeconds   float64 // Position of the poster frame; videos shorter than that use their midpoint
+	ThumbnailCount        int     // Thumbnails spread evenly over the video
+	ThumbnailWidth        int     // Pixels; height follows the aspect ratio
+	SpriteIntervalSeconds int     // One sprite tile every N seconds (stretched for very long videos)
+	SpriteTileWidth       int     // Pixels per sprite tile; height follows the aspect ratio
+	SpriteColumns         int     // Tiles per sprite sheet row
+
+	// Captions
+	CaptionMaxBytes        int64  // Largest caption file accepted by POST /uploads/captions
+	CaptionDefaultLanguage string // Track sent as transcript_url in video webhooks
+
+	// Local JWT verification
+	JWTLocalVerify     bool   // Verify user tokens locally before calling main backend
+	JWKSFile           string // Path to a JWKS file with RS256 public keys
+	JWKSURL            string // URL of a JWKS endpoint with RS256 public keys
+	JWKSRefreshSeconds int    // How often to refetch JWKS_URL (seconds)
+	JWTIssuer          string // Expected "iss" claim (optional)
+	JWTAudience        string // Expected "aud" claim (optional)
+
+	// Main backend client
+	BackendAuthTimeout      int // Timeout for verify-lesson-access calls, retries included (seconds)
+	BackendWebhookTimeout   int // Timeout for ready webhooks (seconds)
+	BackendMaxRetries       int // Retries for idempotent calls
+	BackendMaxIdleConns     int // Pooled keep-alive connections to the main backend
+	BackendBreakerThreshold int // Consecutive failures before the circuit opens, 0 disables
+	BackendBreakerCooldown  int // How long the circuit stays open (seconds)
+
+	// Signed download URLs
+	SignedURLsEnabled bool   // Mint signed URLs and include them in ready webhooks
+	SignedURLSecret   string // Shared secret (also configured in nginx secure_link_md5)
+	SignedURLMode     string // "hmac" (verified by storage-backend) or "nginx" (secure_link)
+	SignedURLTTL      int    // Default lifetime of a signed URL (seconds)
+	SignedURLBindIP   bool   // nginx mode: include the client address in the signature
+
+	// nginx auth_request
+	AuthzCookieName string   // Cookie carrying the user token when no Authorization header is sent
+	TrustedProxies  []string // Addresses or CIDRs whose X-Real-IP header names the client; empty trusts none
+
+	// Go-served downloads (/files/...)
+	FilesRequireAuth bool // Require a signed URL or lesson access for /files downloads; videos always need it with HLSEncryption
+
+	// Reconciliation with the main backend
+	ReconcileBatchSize       int  // Lessons per reconcile request
+	ReconcileIntervalMinutes int  // Run the reconcile job periodically, 0 disables
+	ReconcileDryRun          bool // Periodic job only reports orphans
+	ReconcileMinAgeMinutes   int  // Orphans changed more recently than this are left alone
+
+	// Soft delete
+	TrashRetentionHours       int // Keep deleted files this long, 0 deletes permanently
+	TrashPurgeIntervalMinutes int // How often expired trash is purged
+
+	// Lesson access cache
+	AuthCacheSize        int // Max cached (token, lesson) decisions, 0 disables the cache
+	AuthCachePositiveTTL int // TTL for granted decisions (seconds)
+	AuthCacheNegativeTTL int // TTL for denied decisions (seconds)
 
 	// Performance tuning
 	FileWriteWorkers int // Number of async file writers
@@ -34,6 +117,10 @@ func Load() *Config {
 	chunkSize, _ := strconv.ParseInt(getEnv("CHUNK_SIZE", "16777216"), 10, 64) // 16MB default
 	maxConcurrent, _ := strconv.Atoi(getEnv("MAX_CONCURRENT_UPLOADS", "50"))   // Increased to 50
 	mergeWorkers, _ := strconv.Atoi(getEnv("MERGE_WORKERS", "5"))
+	packageWorkers, _ := strconv.Atoi(getEnv("PACKAGE_WORKERS", "1"))
+	if packageWorkers < 1 {
+		packageWorkers = 1
+	}
 
 	// Performance tuning parameters
 	fileWriteWorkers, _ := strconv.Atoi(getEnv("FILE_WRITE_WORKERS", "30"))
@@ -43,6 +130,79 @@ func Load() *Config {
 	httpReadTimeout, _ := strconv.Atoi(getEnv("HTTP_READ_TIMEOUT", "600"))        // 10 min
 	httpWriteTimeout, _ := strconv.Atoi(getEnv("HTTP_WRITE_TIMEOUT", "600"))      // 10 min
 
+	// Local JWT verification
+	jwtLocalVerify, _ := strconv.ParseBool(getEnv("JWT_LOCAL_VERIFY", "false"))
+	jwksRefreshSeconds, _ := strconv.Atoi(getEnv("JWKS_REFRESH_SECONDS", "3600")) // 1 hour
+
+	// Main backend client
+	backendAuthTimeout, _ := strconv.Atoi(getEnv("BACKEND_AUTH_TIMEOUT", "5"))
+	backendWebhookTimeout, _ := strconv.Atoi(getEnv("BACKEND_WEBHOOK_TIMEOUT", "10"))
+	backendMaxRetries, _ := strconv.Atoi(getEnv("BACKEND_MAX_RETRIES", "2"))
+	backendMaxIdleConns, _ := strconv.Atoi(getEnv("BACKEND_MAX_IDLE_CONNS", "32"))
+	backendBreakerThreshold, _ := strconv.Atoi(getEnv("BACKEND_BREAKER_THRESHOLD", "5"))
+	backendBreakerCooldown, _ := strconv.Atoi(getEnv("BACKEND_BREAKER_COOLDOWN", "30"))
+
+	// Signed download URLs
+	signedURLsEnabled, _ := strconv.ParseBool(getEnv("SIGNED_URLS_ENABLED", "false"))
+	signedURLTTL, _ := strconv.Atoi(getEnv("SIGNED_URL_TTL", "21600")) // 6 hours
+	signedURLBindIP, _ := strconv.ParseBool(getEnv("SIGNED_URL_BIND_IP", "false"))
+
+	// Go-served downloads
+	filesRequireAuth, _ := strconv.ParseBool(getEnv("FILES_REQUIRE_AUTH", "false"))
+
+	// Reconciliation
+	reconcileBatchSize, _ := strconv.Atoi(getEnv("RECONCILE_BATCH_SIZE", "100"))
+	reconcileIntervalMinutes, _ := strconv.Atoi(getEnv("RECONCILE_INTERVAL_MINUTES", "0"))
+	reconcileDryRun, err := strconv.ParseBool(getEnv("RECONCILE_DRY_RUN", "true"))
+	if err != nil {
+		reconcileDryRun = true // A typo must not turn on quarantining
+	}
+	reconcileMinAgeMinutes, _ := strconv.Atoi(getEnv("RECONCILE_MIN_AGE_MINUTES", "1440"))
+
+	// Upload processing
+	validateVideos, _ := strconv.ParseBool(getEnv("VALIDATE_VIDEOS", "true"))
+	allowedVideoTypes := splitList(getEnv("ALLOWED_VIDEO_TYPES", "video/mp4,video/quicktime,video/webm,video/x-matroska,video/x-msvideo,video/avi"))
+	transcodeCRF, _ := strconv.Atoi(getEnv("TRANSCODE_CRF", "23"))
+	faststart, _ := strconv.ParseBool(getEnv("FASTSTART_ENABLED", "true"))
+	videoVersionsKeep, _ := strconv.Atoi(getEnv("VIDEO_VERSIONS_KEEP", "5"))
+	// A typo must not remove the limit
+	mediaProbeTimeout, err := strconv.Atoi(getEnv("MEDIA_PROBE_TIMEOUT_SECONDS", "60"))
+	if err != nil {
+		mediaProbeTimeout = 60
+	}
+	mediaEncodeTimeout, err := strconv.Atoi(getEnv("MEDIA_ENCODE_TIMEOUT_SECONDS", "14400"))
+	if err != nil {
+		mediaEncodeTimeout = 14400
+	}
+
+	// HLS packaging
+	hlsEnabled, _ := strconv.ParseBool(getEnv("HLS_ENABLED", "false"))
+	hlsRenditions := splitInts(getEnv("HLS_RENDITIONS", "360,720,1080"))
+	hlsSegmentSeconds, _ := strconv.Atoi(getEnv("HLS_SEGMENT_SECONDS", "6"))
+	hlsEncryption, _ := strconv.ParseBool(getEnv("HLS_ENCRYPTION", "false"))
+	dashEnabled, _ := strconv.ParseBool(getEnv("DASH_ENABLED", "false"))
+
+	// Preview images
+	previewImages, _ := strconv.ParseBool(getEnv("PREVIEW_IMAGES_ENABLED", "true"))
+	posterOffsetSeconds, _ := strconv.ParseFloat(getEnv("POSTER_OFFSET_SECONDS", "5"), 64)
+	thumbnailCount, _ := strconv.Atoi(getEnv("THUMBNAIL_COUNT", "5"))
+	thumbnailWidth, _ := strconv.Atoi(getEnv("THUMBNAIL_WIDTH", "320"))
+	spriteIntervalSeconds, _ := strconv.Atoi(getEnv("SPRITE_INTERVAL_SECONDS", "10"))
+	spriteTileWidth, _ := strconv.Atoi(getEnv("SPRITE_TILE_WIDTH", "160"))
+	spriteColumns, _ := strconv.Atoi(getEnv("SPRITE_COLUMNS", "10"))
+
+	// Captions
+	captionMaxBytes, _ := strconv.ParseInt(getEnv("CAPTION_MAX_BYTES", "5242880"), 10, 64) // 5MB
+
+	// Soft delete
+	trashRetentionHours, _ := strconv.Atoi(getEnv("TRASH_RETENTION_HOURS", "720")) // 30 days
+	trashPurgeIntervalMinutes, _ := strconv.Atoi(getEnv("TRASH_PURGE_INTERVAL_MINUTES", "60"))
+
+	// Lesson access cache
+	authCacheSize, _ := strconv.Atoi(getEnv("AUTH_CACHE_SIZE", "10000"))
+	authCachePositiveTTL, _ := strconv.Atoi(getEnv("AUTH_CACHE_POSITIVE_TTL", "300")) // 5 min
+	authCacheNegativeTTL, _ := strconv.Atoi(getEnv("AUTH_CACHE_NEGATIVE_TTL", "30"))  // 30 sec
+
 	// Get base directory (parent of storage-backend)
 	baseDir := getEnv("BASE_DIR", "../file_uploads")
 	absBaseDir, _ := filepath.Abs(baseDir)
@@ -54,25 +214,116 @@ func Load() *Config {
 	}
 
 	return &Config{
-		ServerAddr:       getEnv("SERVER_ADDR", ":8080"),
-		UploadTmpDir:     filepath.Join(absBaseDir, "uploads/tmp"),
-		VideosDir:        filepath.Join(absBaseDir, "videos"),
-		MaterialsDir:     filepath.Join(absBaseDir, "materials"),
-		ChunkSize:        chunkSize,
-		MaxConcurrent:    maxConcurrent,
-		MergeWorkers:     mergeWorkers,
-		MainBackendURL:   getEnv("MAIN_BACKEND_URL", "http://localhost:8000"),
-		PublicBaseURL:    publicBase,
-		FFProbePath:      getEnv("FFPROBE_PATH", "ffprobe"),
-		JWTSecret:        getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		InternalAPIKey:   getEnv("INTERNAL_API_KEY", "change-this-to-a-secure-random-key-in-production"),
-		FileWriteWorkers: fileWriteWorkers,
-		WriteQueueSize:   writeQueueSize,
-		UploadBufferSize: uploadBufferSize,
-		MergeBufferSize:  mergeBufferSize,
-		HTTPReadTimeout:  httpReadTimeout,
-		HTTPWriteTimeout: httpWriteTimeout,
+		ServerAddr:                getEnv("SERVER_ADDR", ":8080"),
+		UploadTmpDir:              filepath.Join(absBaseDir, "uploads/tmp"),
+		VideosDir:                 filepath.Join(absBaseDir, "videos"),
+		MaterialsDir:              filepath.Join(absBaseDir, "materials"),
+		QuarantineDir:             filepath.Join(absBaseDir, "quarantine"),
+		TrashDir:                  filepath.Join(absBaseDir, "trash"),
+		KeysDir:                   filepath.Join(absBaseDir, "keys"),
+		ChunkSize:                 chunkSize,
+		MaxConcurrent:             maxConcurrent,
+		MergeWorkers:              mergeWorkers,
+		PackageWorkers:            packageWorkers,
+		MainBackendURL:            getEnv("MAIN_BACKEND_URL", "http://localhost:8000"),
+		PublicBaseURL:             publicBase,
+		FFProbePath:               getEnv("FFPROBE_PATH", "ffprobe"),
+		FFmpegPath:                getEnv("FFMPEG_PATH", "ffmpeg"),
+		ValidateVideos:            validateVideos,
+		AllowedVideoTypes:         allowedVideoTypes,
+		TranscodePreset:           getEnv("TRANSCODE_PRESET", "veryfast"),
+		TranscodeCRF:              transcodeCRF,
+		MediaProbeTimeout:         mediaProbeTimeout,
+		MediaEncodeTimeout:        mediaEncodeTimeout,
+		Faststart:                 faststart,
+		VideoVersionsKeep:         videoVersionsKeep,
+		HLSEnabled:                hlsEnabled,
+		HLSRenditions:             hlsRenditions,
+		HLSSegmentSeconds:         hlsSegmentSeconds,
+		HLSEncryption:             hlsEncryption,
+		HLSKeyBaseURL:             getEnv("HLS_KEY_BASE_URL", publicBase),
+		DASHEnabled:               dashEnabled,
+		PreviewImages:             previewImages,
+		PosterOffsetSeconds:       posterOffsetSeconds,
+		ThumbnailCount:            thumbnailCount,
+		ThumbnailWidth:            thumbnailWidth,
+		SpriteIntervalSeconds:     spriteIntervalSeconds,
+		SpriteTileWidth:           spriteTileWidth,
+		SpriteColumns:             spriteColumns,
+		CaptionMaxBytes:           captionMaxBytes,
+		CaptionDefaultLanguage:    strings.ToLower(getEnv("CAPTION_DEFAULT_LANGUAGE", "en")),
+		JWTSecret:                 os.Getenv("JWT_SECRET"),
+		IDPattern:                 getEnv("ID_PATTERN", ""),
+		InternalAPIKey:            getEnv("INTERNAL_API_KEY", "change-this-to-a-secure-random-key-in-production"),
+		JWTLocalVerify:            jwtLocalVerify,
+		JWKSFile:                  os.Getenv("JWKS_FILE"),
+		JWKSURL:                   os.Getenv("JWKS_URL"),
+		JWKSRefreshSeconds:        jwksRefreshSeconds,
+		JWTIssuer:                 os.Getenv("JWT_ISSUER"),
+		JWTAudience:               os.Getenv("JWT_AUDIENCE"),
+		BackendAuthTimeout:        backendAuthTimeout,
+		BackendWebhookTimeout:     backendWebhookTimeout,
+		BackendMaxRetries:         backendMaxRetries,
+		BackendMaxIdleConns:       backendMaxIdleConns,
+		BackendBreakerThreshold:   backendBreakerThreshold,
+		BackendBreakerCooldown:    backendBreakerCooldown,
+		SignedURLsEnabled:         signedURLsEnabled,
+		SignedURLSecret:           os.Getenv("SIGNED_URL_SECRET"),
+		SignedURLMode:             getEnv("SIGNED_URL_MODE", "hmac"),
+		SignedURLTTL:              signedURLTTL,
+		SignedURLBindIP:           signedURLBindIP,
+		AuthzCookieName:           getEnv("AUTHZ_COOKIE_NAME", "access_token"),
+		TrustedProxies:            splitList(os.Getenv("TRUSTED_PROXIES")),
+		FilesRequireAuth:          filesRequireAuth,
+		ReconcileBatchSize:        reconcileBatchSize,
+		ReconcileIntervalMinutes:  reconcileIntervalMinutes,
+		ReconcileDryRun:           reconcileDryRun,
+		ReconcileMinAgeMinutes:    reconcileMinAgeMinutes,
+		TrashRetentionHours:       trashRetentionHours,
+		TrashPurgeIntervalMinutes: trashPurgeIntervalMinutes,
+		AuthCacheSize:             authCacheSize,
+		AuthCachePositiveTTL:      authCachePositiveTTL,
+		AuthCacheNegativeTTL:      authCacheNegativeTTL,
+		FileWriteWorkers:          fileWriteWorkers,
+		WriteQueueSize:            writeQueueSize,
+		UploadBufferSize:          uploadBufferSize,
+		MergeBufferSize:           mergeBufferSize,
+		HTTPReadTimeout:           httpReadTimeout,
+		HTTPWriteTimeout:          httpWriteTimeout,
+	}
+}
+
+// placeholderJWTSecrets are example secrets that shipped in configs; anyone can sign tokens with them
+var placeholderJWTSecrets = map[string]bool{
+	"your-secret-key-change-in-production": true,
+	"CHANGE_ME_SECRET":                     true,
+}
+
+// HS256Enabled reports whether JWT_SECRET is set to a real secret that HS256 tokens can be checked with
+func (c *Config) HS256Enabled() bool {
+	return c.JWTSecret != "" && !placeholderJWTSecrets[c.JWTSecret]
+}
+
+// splitList parses a comma-separated value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitInts parses a comma-separated list of positive integers, dropping anything else
+func splitInts(value string) []int {
+	var numbers []int
+	for _, item := range splitList(value) {
+		if n, err := strconv.Atoi(item); err == nil && n > 0 {
+			numbers = append(numbers, n)
+		}
 	}
+	return numbers
 }
 
 func getEnv(key, defaultValue string) string {
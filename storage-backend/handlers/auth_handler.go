@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"storage-backend/config"
+	"storage-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthHandler exposes auth-related internal endpoints to the main backend
+type AuthHandler struct {
+	authSvc *services.AuthService
+	cfg     *config.Config
+}
+
+// NewAuthHandler creates a new auth handler
+func NewAuthHandler(authSvc *services.AuthService, cfg *config.Config) *AuthHandler {
+	return &AuthHandler{authSvc: authSvc, cfg: cfg}
+}
+
+type invalidateAccessRequest struct {
+	UserID   string `json:"user_id"`
+	LessonID string `json:"lesson_id"`
+}
+
+// InvalidateAccessCache handles POST /internal/auth/invalidate
+// The main backend calls this when a user's enrollment or a lesson's permissions change.
+func (h *AuthHandler) InvalidateAccessCache(c *gin.Context) {
+	if !authorizeInternal(c, h.cfg) {
+		return
+	}
+
+	var req invalidateAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	if req.UserID == "" && req.LessonID == "" {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "user_id or lesson_id is required"))
+		return
+	}
+
+	removed := h.authSvc.InvalidateAccess(req.UserID, req.LessonID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "access cache invalidated",
+		"user_id":   req.UserID,
+		"lesson_id": req.LessonID,
+		"removed":   removed,
+	})
+}
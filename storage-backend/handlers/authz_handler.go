@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"storage-backend/config"
+	"storage-backend/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthzHandler answers nginx auth_request subrequests for media downloads
+type AuthzHandler struct {
+	authSvc *services.AuthService
+	signer  *services.URLSigner
+	cfg     *config.Config
+}
+
+// NewAuthzHandler creates a new authz handler
+func NewAuthzHandler(authSvc *services.AuthService, signer *services.URLSigner, cfg *config.Config) *AuthzHandler {
+	return &AuthzHandler{authSvc: authSvc, signer: signer, cfg: cfg}
+}
+
+// Authorize handles GET /authz
+// nginx passes the original request URI in X-Original-URI. Only the status matters:
+// 200 allows the download, 401/403 deny it.
+func (h *AuthzHandler) Authorize(c *gin.Context) {
+	originalURI := c.GetHeader("X-Original-URI")
+	if originalURI == "" {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	u, err := url.ParseRequestURI(originalURI)
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	lessonID, ok := lessonIDFromMediaPath(h.cfg, u.Path)
+	if !ok {
+		log.Printf("🚫 authz: not a media path: %s", u.Path)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	c.Status(mediaAccessStatus(c, h.authSvc, h.signer, h.cfg, u.Path, u.Query(), lessonID))
+}
+
+// AuthorizeClearMedia handles GET /authz/clear-media, the auth_request nginx runs for /videos/ files when
+// configured for HLS_ENCRYPTION (see nginx/nginx.conf).
+// With HLS_ENCRYPTION on, the MP4, preview images and captions of a video would give away what the
+// encrypted segments protect, so they need lesson access like the keys. Encrypted HLS playlists and
+// segments stay public, as does everything while encryption is off.
+func (h *AuthzHandler) AuthorizeClearMedia(c *gin.Context) {
+	if !h.cfg.HLSEncryption {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	u, err := url.ParseRequestURI(c.GetHeader("X-Original-URI"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	lessonID, ok := lessonIDFromMediaPath(h.cfg, u.Path)
+	if !ok || !strings.HasPrefix(u.Path, "/videos/") {
+		log.Printf("🚫 authz: not a video path: %s", u.Path)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if !clearMediaNeedsAccess(h.cfg, u.Path) {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Status(mediaAccessStatus(c, h.authSvc, h.signer, h.cfg, u.Path, u.Query(), lessonID))
+}
+
+// clearMediaNeedsAccess reports whether a /videos/ file needs lesson access because HLS_ENCRYPTION
+// is on: everything but the encrypted HLS ladder. /authz/clear-media and /files/videos share the rule.
+func clearMediaNeedsAccess(cfg *config.Config, mediaPath string) bool {
+	return cfg.HLSEncryption && strings.HasPrefix(mediaPath, "/videos/") && !isHLSPath(mediaPath)
+}
+
+// isHLSPath reports whether a canonical /videos/<lesson>/<video>/v<N>/hls/... path is part of an HLS ladder
+func isHLSPath(mediaPath string) bool {
+	segments := strings.Split(strings.TrimPrefix(mediaPath, "/"), "/")
+	return len(segments) > 5 && segments[4] == services.HLSDirName
+}
+
+// mediaAccessStatus decides whether the caller may download a file under /videos/ or /materials/.
+// A valid signed URL is enough on its own; otherwise the caller's token must grant lesson access.
+// IP-bound signatures are checked against c.ClientIP(), which takes X-Real-IP only from TRUSTED_PROXIES.
+// It returns http.StatusOK when allowed, otherwise the status to deny with.
+func mediaAccessStatus(c *gin.Context, authSvc *services.AuthService, signer *services.URLSigner, cfg *config.Config,
+	path string, query url.Values, lessonID string) int {
+	if signer.Enabled() && (query.Get("sig") != "" || query.Get("md5") != "") {
+		if _, err := signer.Verify(path, query, c.ClientIP()); err == nil {
+			return http.StatusOK
+		}
+	}
+
+	token := bearerToken(c, cfg.AuthzCookieName)
+	if token == "" {
+		return http.StatusUnauthorized
+	}
+
+	if err := authSvc.VerifyLessonAccess(token, lessonID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrAuthenticationFailed):
+			return http.StatusUnauthorized
+		case errors.Is(err, services.ErrAccessDenied), errors.Is(err, services.ErrLessonNotFound):
+			return http.StatusForbidden
+		default:
+			log.Printf("❗️authz: access check failed for lesson %s: %v", lessonID, err)
+			return http.StatusServiceUnavailable
+		}
+	}
+
+	return http.StatusOK
+}
+
+// lessonIDFromMediaPath extracts <lesson> from /videos/<lesson>/... or /materials/<lesson>/...
+// The decoded path must already be canonical: nginx resolves "." and ".." segments and merges
+// slashes before serving, so /videos/<a>/../<b>/... would be checked against <a> but serve <b>.
+func lessonIDFromMediaPath(cfg *config.Config, mediaPath string) (string, bool) {
+	if !strings.HasPrefix(mediaPath, "/") || path.Clean(mediaPath) != mediaPath {
+		return "", false
+	}
+	segments := strings.Split(strings.TrimPrefix(mediaPath, "/"), "/")
+	if len(segments) < 3 {
+		return "", false
+	}
+	if segments[0] != "videos" && segments[0] != "materials" {
+		return "", false
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+	if !validID(cfg, segments[1]) {
+		return "", false
+	}
+	return segments[1], true
+}
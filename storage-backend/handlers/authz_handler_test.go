@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"storage-backend/config"
+	"storage-backend/services"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLessonIDFromMediaPath(t *testing.T) {
+	const (
+		lessonA = "3f2504e0-4f89-11d3-9a0c-0305e82c3301"
+		lessonB = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+		video   = "7b62f067-0316-4706-b8fe-23363b89e9a6"
+	)
+	cfg := &config.Config{}
+
+	cases := []struct {
+		uri    string // As nginx passes it in X-Original-URI
+		lesson string // Empty when the path must be rejected
+	}{
+		{"/videos/" + lessonA + "/" + video + "/v1/video.mp4", lessonA},
+		{"/videos/" + lessonA + "/video.mp4", lessonA},
+		{"/materials/" + lessonA + "/" + video + "/notes.pdf?sig=x&expires=1", lessonA},
+		{"/videos/" + lessonA + "/" + video + "/v1/hls/720p/seg_00001.ts", lessonA},
+
+		// Traversal into another lesson, plain and percent-encoded
+		{"/videos/" + lessonA + "/../" + lessonB + "/" + video + "/video.mp4", ""},
+		{"/videos/" + lessonA + "/%2e%2e/" + lessonB + "/" + video + "/video.mp4", ""},
+		{"/videos/" + lessonA + "/%2E%2E/" + lessonB + "/" + video + "/video.mp4", ""},
+		{"/videos/" + lessonA + "/..%2f" + lessonB + "/" + video + "/video.mp4", ""},
+		{"/videos/" + lessonA + "%2f..%2f" + lessonB + "/" + video + "/video.mp4", ""},
+		{"/videos/" + lessonA + "/" + video + "/../../" + lessonB + "/video.mp4", ""},
+		{"/videos/../videos/" + lessonB + "/video.mp4", ""},
+		{"/materials/" + lessonA + "/./" + video + "/notes.pdf", ""},
+
+		// Paths nginx would normalize differently from the raw segments
+		{"/videos//" + lessonB + "/video.mp4", ""},
+		{"/videos/" + lessonA + "//" + video + "/video.mp4", ""},
+		{"/videos/" + lessonA + "/" + video + "/", ""},
+		{"//videos/" + lessonA + "/video.mp4", ""},
+
+		// Not a lesson ID or not a media path
+		{"/videos/..", ""},
+		{"/videos/" + lessonA, ""},
+		{"/videos/not-a-lesson/video.mp4", ""},
+		{"/videos/" + lessonA + "%00/video.mp4", ""},
+		{"/keys/" + lessonA + "/" + video + "/1", ""},
+		{"/other/" + lessonA + "/video.mp4", ""},
+	}
+
+	for _, tc := range cases {
+		u, err := url.ParseRequestURI(tc.uri)
+		if err != nil {
+			if tc.lesson != "" {
+				t.Errorf("ParseRequestURI(%q) failed: %v", tc.uri, err)
+			}
+			continue
+		}
+		lesson, ok := lessonIDFromMediaPath(cfg, u.Path)
+		if tc.lesson == "" {
+			if ok {
+				t.Errorf("lessonIDFromMediaPath(%q) = %q, want rejection", tc.uri, lesson)
+			}
+			continue
+		}
+		if !ok || lesson != tc.lesson {
+			t.Errorf("lessonIDFromMediaPath(%q) = %q, %v, want %q", tc.uri, lesson, ok, tc.lesson)
+		}
+	}
+}
+
+func TestAuthorizeClearMedia(t *testing.T) {
+	const prefix = "/videos/3f2504e0-4f89-11d3-9a0c-0305e82c3301/7b62f067-0316-4706-b8fe-23363b89e9a6/v2/"
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		encrypted bool
+		uri       string
+		status    int // Without a token or signature
+	}{
+		{false, prefix + "video.mp4", http.StatusOK},
+		{false, prefix + "images/poster.jpg", http.StatusOK},
+		{true, prefix + "hls/master.m3u8", http.StatusOK},
+		{true, prefix + "hls/720p/seg_00001.ts", http.StatusOK},
+		{true, prefix + "video.mp4", http.StatusUnauthorized},
+		{true, prefix + "images/poster.jpg", http.StatusUnauthorized},
+		{true, prefix + "images/sprite.jpg", http.StatusUnauthorized},
+		{true, "/videos/3f2504e0-4f89-11d3-9a0c-0305e82c3301/7b62f067-0316-4706-b8fe-23363b89e9a6/captions/en.vtt", http.StatusUnauthorized},
+		{true, prefix + "hls", http.StatusUnauthorized},
+		{true, prefix + "hls/../video.mp4", http.StatusForbidden},
+		{true, "/materials/3f2504e0-4f89-11d3-9a0c-0305e82c3301/notes/notes.pdf", http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		cfg := &config.Config{HLSEncryption: tc.encrypted}
+		h := NewAuthzHandler(nil, services.NewURLSigner(cfg), cfg)
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/authz/clear-media", nil)
+		c.Request.Header.Set("X-Original-URI", tc.uri)
+		h.AuthorizeClearMedia(c)
+
+		if got := c.Writer.Status(); got != tc.status {
+			t.Errorf("encrypted=%v %s: status %d, want %d", tc.encrypted, tc.uri, got, tc.status)
+		}
+	}
+}
+
+func TestMediaAccessStatusBoundIP(t *testing.T) {
+	const (
+		mediaPath = "/videos/3f2504e0-4f89-11d3-9a0c-0305e82c3301/video.mp4"
+		boundIP   = "203.0.113.5"
+		proxy     = "10.0.0.10"
+	)
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{SignedURLsEnabled: true, SignedURLSecret: "secret", SignedURLTTL: 60}
+	signer := services.NewURLSigner(cfg)
+	signed, err := signer.Sign(services.SignURLOptions{Path: mediaPath, ClientIP: boundIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Configured like main: X-Real-IP only from the trusted proxy
+	r := gin.New()
+	r.RemoteIPHeaders = []string{"X-Real-IP"}
+	if err := r.SetTrustedProxies([]string{proxy}); err != nil {
+		t.Fatal(err)
+	}
+	r.GET("/videos/*path", func(c *gin.Context) {
+		c.Status(mediaAccessStatus(c, nil, signer, cfg, c.Request.URL.Path, c.Request.URL.Query(), "3f2504e0-4f89-11d3-9a0c-0305e82c3301"))
+	})
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		status     int // Without a token
+	}{
+		{"bound client directly", boundIP + ":40000", "", http.StatusOK},
+		{"bound client through the proxy", proxy + ":40000", boundIP, http.StatusOK},
+		{"other client through the proxy", proxy + ":40000", "198.51.100.7", http.StatusUnauthorized},
+		{"other client claiming the bound address", "198.51.100.7:40000", boundIP, http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.realIP != "" {
+			req.Header.Set("X-Real-IP", tc.realIP)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.status)
+		}
+	}
+}
@@ -4,38 +4,38 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"storage-backend/config"
+	"storage-backend/models"
+	"storage-backend/services"
+	"storage-backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
-// DeleteHandler handles file deletion requests from main backend
+// deleteItemError is reported for an item that could not be deleted; the cause is logged, not returned
+const deleteItemError = "failed to delete"
+
+// DeleteHandler handles file deletion and restore requests from main backend
 type DeleteHandler struct {
-	cfg *config.Config
+	trashSvc *services.TrashService
+	cfg      *config.Config
 }
 
 // NewDeleteHandler creates a new delete handler
-func NewDeleteHandler(cfg *config.Config) *DeleteHandler {
-	return &DeleteHandler{cfg: cfg}
+func NewDeleteHandler(trashSvc *services.TrashService, cfg *config.Config) *DeleteHandler {
+	return &DeleteHandler{trashSvc: trashSvc, cfg: cfg}
 }
 
 func (h *DeleteHandler) authorize(c *gin.Context) bool {
-	apiKey := c.GetHeader("X-Internal-API-Key")
-	if apiKey != h.cfg.InternalAPIKey {
-		lessonID := c.Param("lesson_id")
-		log.Printf("Unauthorized delete attempt for lesson %s: invalid API key", lessonID)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return false
-	}
-	return true
+	return authorizeInternal(c, h.cfg)
 }
 
 // DeleteLessonFiles handles DELETE /files/:lesson_id
 func (h *DeleteHandler) DeleteLessonFiles(c *gin.Context) {
 	lessonID := c.Param("lesson_id")
-	if lessonID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lesson_id is required"})
+	if !validID(h.cfg, lessonID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"))
 		return
 	}
 
@@ -43,40 +43,45 @@ func (h *DeleteHandler) DeleteLessonFiles(c *gin.Context) {
 		return
 	}
 
-	// Delete video directory
-	videoDir := filepath.Join(h.cfg.VideosDir, lessonID)
-	videoDeleted := false
-	if err := os.RemoveAll(videoDir); err != nil {
-		log.Printf("Failed to delete video directory %s: %v", videoDir, err)
-	} else {
-		videoDeleted = true
-		log.Printf("Deleted video directory: %s", videoDir)
+	batchID := uuid.NewString()
+	items := h.trashLessonVideos(lessonID, batchID)
+	items = append(items, h.trashLessonMaterials(lessonID, batchID)...)
+
+	respondDelete(c, &models.DeleteResponse{
+		Message:  "lesson files deleted",
+		LessonID: lessonID,
+		BatchID:  batchID,
+		Items:    items,
+	})
+}
+
+// DeleteLessonVideo handles DELETE /files/:lesson_id/video and deletes every video of the lesson
+func (h *DeleteHandler) DeleteLessonVideo(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	if !validID(h.cfg, lessonID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"))
+		return
 	}
 
-	// Delete materials directory
-	materialsDir := filepath.Join(h.cfg.MaterialsDir, lessonID)
-	materialsDeleted := false
-	if err := os.RemoveAll(materialsDir); err != nil {
-		log.Printf("Failed to delete materials directory %s: %v", materialsDir, err)
-	} else {
-		materialsDeleted = true
-		log.Printf("Deleted materials directory: %s", materialsDir)
+	if !h.authorize(c) {
+		return
 	}
 
-	// Return success if at least one deletion succeeded
-	c.JSON(http.StatusOK, gin.H{
-		"message":           "lesson files deleted",
-		"lesson_id":         lessonID,
-		"video_deleted":     videoDeleted,
-		"materials_deleted": materialsDeleted,
+	batchID := uuid.NewString()
+	respondDelete(c, &models.DeleteResponse{
+		Message:  "lesson video deleted",
+		LessonID: lessonID,
+		BatchID:  batchID,
+		Items:    h.trashLessonVideos(lessonID, batchID),
 	})
 }
 
-// DeleteLessonVideo handles DELETE /files/:lesson_id/video
-func (h *DeleteHandler) DeleteLessonVideo(c *gin.Context) {
+// DeleteVideo handles DELETE /files/:lesson_id/videos/:video_id
+func (h *DeleteHandler) DeleteVideo(c *gin.Context) {
 	lessonID := c.Param("lesson_id")
-	if lessonID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lesson_id is required"})
+	videoID := c.Param("video_id")
+	if !validID(h.cfg, lessonID) || !validFileID(videoID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id or video_id"))
 		return
 	}
 
@@ -84,19 +89,16 @@ func (h *DeleteHandler) DeleteLessonVideo(c *gin.Context) {
 		return
 	}
 
-	videoDir := filepath.Join(h.cfg.VideosDir, lessonID)
-	deleted := false
-	if err := os.RemoveAll(videoDir); err != nil {
-		log.Printf("Failed to delete video directory %s: %v", videoDir, err)
-	} else {
-		deleted = true
-		log.Printf("Deleted video directory: %s", videoDir)
-	}
+	batchID := uuid.NewString()
+	item := h.trash(models.TrashKindVideo, lessonID, videoID, batchID, h.cfg.VideosDir, lessonID, videoID)
+	h.removeIfEmpty(h.cfg.VideosDir, lessonID)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":   "lesson video deleted",
-		"lesson_id": lessonID,
-		"deleted":   deleted,
+	respondDelete(c, &models.DeleteResponse{
+		Message:  "lesson video deleted",
+		LessonID: lessonID,
+		VideoID:  videoID,
+		BatchID:  batchID,
+		Items:    []models.DeleteItemResult{item},
 	})
 }
 
@@ -104,8 +106,8 @@ func (h *DeleteHandler) DeleteLessonVideo(c *gin.Context) {
 func (h *DeleteHandler) DeleteLessonMaterial(c *gin.Context) {
 	lessonID := c.Param("lesson_id")
 	materialID := c.Param("material_id")
-	if lessonID == "" || materialID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lesson_id and material_id are required"})
+	if !validID(h.cfg, lessonID) || !validFileID(materialID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id or material_id"))
 		return
 	}
 
@@ -113,19 +115,270 @@ func (h *DeleteHandler) DeleteLessonMaterial(c *gin.Context) {
 		return
 	}
 
-	materialDir := filepath.Join(h.cfg.MaterialsDir, lessonID, materialID)
-	deleted := false
-	if err := os.RemoveAll(materialDir); err != nil {
-		log.Printf("Failed to delete material directory %s: %v", materialDir, err)
-	} else {
-		deleted = true
-		log.Printf("Deleted material directory: %s", materialDir)
+	batchID := uuid.NewString()
+	item := h.trash(models.TrashKindMaterial, lessonID, materialID, batchID, h.cfg.MaterialsDir, lessonID, materialID)
+	h.removeIfEmpty(h.cfg.MaterialsDir, lessonID)
+
+	respondDelete(c, &models.DeleteResponse{
+		Message:    "lesson material deleted",
+		LessonID:   lessonID,
+		MaterialID: materialID,
+		BatchID:    batchID,
+		Items:      []models.DeleteItemResult{item},
+	})
+}
+
+// RestoreLessonFiles handles POST /internal/files/:lesson_id/restore?batch_id=
+// and restores one delete request of the lesson, the most recent without batch_id
+func (h *DeleteHandler) RestoreLessonFiles(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	if !validID(h.cfg, lessonID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"))
+		return
+	}
+
+	if !h.authorize(c) {
+		return
+	}
+
+	h.restore(c, lessonID, "", "")
+}
+
+// RestoreVideo handles POST /internal/files/:lesson_id/videos/:video_id/restore
+func (h *DeleteHandler) RestoreVideo(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	videoID := c.Param("video_id")
+	if !validID(h.cfg, lessonID) || !validFileID(videoID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id or video_id"))
+		return
+	}
+
+	if !h.authorize(c) {
+		return
+	}
+
+	h.restore(c, lessonID, models.TrashKindVideo, videoID)
+}
+
+// RestoreLessonMaterial handles POST /internal/files/:lesson_id/materials/:material_id/restore
+func (h *DeleteHandler) RestoreLessonMaterial(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	materialID := c.Param("material_id")
+	if !validID(h.cfg, lessonID) || !validFileID(materialID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id or material_id"))
+		return
+	}
+
+	if !h.authorize(c) {
+		return
+	}
+
+	h.restore(c, lessonID, models.TrashKindMaterial, materialID)
+}
+
+// RestoreTrashItem handles POST /internal/trash/:trash_id/restore and restores a single item,
+// including one an upload replaced
+func (h *DeleteHandler) RestoreTrashItem(c *gin.Context) {
+	trashID := c.Param("trash_id")
+	if !validFileID(trashID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid trash_id"))
+		return
+	}
+
+	if !h.authorize(c) {
+		return
+	}
+
+	item, err := h.trashSvc.RestoreItem(trashID)
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":     "lesson material deleted",
-		"lesson_id":   lessonID,
-		"material_id": materialID,
-		"deleted":     deleted,
+		"message":   "trash item restored",
+		"lesson_id": item.LessonID,
+		"restored":  []models.TrashItem{*item},
 	})
 }
+
+// ListTrash handles GET /internal/trash?lesson_id=
+func (h *DeleteHandler) ListTrash(c *gin.Context) {
+	if !h.authorize(c) {
+		return
+	}
+
+	items, err := h.trashSvc.List(c.Query("lesson_id"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":           items,
+		"retention_hours": h.cfg.TrashRetentionHours,
+	})
+}
+
+// restore restores the delete batch named by the batch_id query parameter, or the most recent one
+func (h *DeleteHandler) restore(c *gin.Context, lessonID, kind, fileID string) {
+	batchID := c.Query("batch_id")
+	if batchID != "" && !validFileID(batchID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid batch_id"))
+		return
+	}
+
+	restored, err := h.trashSvc.Restore(lessonID, kind, fileID, batchID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "lesson files restored",
+		"lesson_id": lessonID,
+		"restored":  restored,
+	})
+}
+
+// trashLessonVideos moves each video of a lesson to the trash separately,
+// including a legacy video.mp4 stored directly in the lesson directory
+func (h *DeleteHandler) trashLessonVideos(lessonID, batchID string) []models.DeleteItemResult {
+	var results []models.DeleteItemResult
+
+	entries, err := h.lessonEntries(h.cfg.VideosDir, lessonID)
+	if err != nil {
+		return []models.DeleteItemResult{{Kind: models.TrashKindVideo, Status: models.DeleteStatusError, Error: deleteItemError}}
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir():
+			results = append(results, h.trash(models.TrashKindVideo, lessonID, entry.Name(), batchID, h.cfg.VideosDir, lessonID, entry.Name()))
+		case entry.Name() == services.VideoFilename:
+			results = append(results, h.trash(models.TrashKindVideo, lessonID, "", batchID, h.cfg.VideosDir, lessonID, entry.Name()))
+		}
+	}
+	h.removeIfEmpty(h.cfg.VideosDir, lessonID)
+
+	if len(results) == 0 {
+		results = append(results, models.DeleteItemResult{Kind: models.TrashKindVideo, Status: models.DeleteStatusNotFound})
+	}
+	return results
+}
+
+// trashLessonMaterials moves each material of a lesson to the trash separately
+// so they can be restored one by one
+func (h *DeleteHandler) trashLessonMaterials(lessonID, batchID string) []models.DeleteItemResult {
+	var results []models.DeleteItemResult
+
+	entries, err := h.lessonEntries(h.cfg.MaterialsDir, lessonID)
+	if err != nil {
+		return []models.DeleteItemResult{{Kind: models.TrashKindMaterial, Status: models.DeleteStatusError, Error: deleteItemError}}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			results = append(results, h.trash(models.TrashKindMaterial, lessonID, entry.Name(), batchID, h.cfg.MaterialsDir, lessonID, entry.Name()))
+		}
+	}
+	h.removeIfEmpty(h.cfg.MaterialsDir, lessonID)
+
+	return results
+}
+
+// lessonEntries lists root/lessonID, treating a missing directory as empty
+func (h *DeleteHandler) lessonEntries(root, lessonID string) ([]os.DirEntry, error) {
+	dir, err := utils.SafeJoin(root, lessonID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to read directory %s: %v", dir, err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// removeIfEmpty drops root/lessonID once nothing is left in it
+func (h *DeleteHandler) removeIfEmpty(root, lessonID string) {
+	if dir, err := utils.SafeJoin(root, lessonID); err == nil {
+		os.Remove(dir)
+	}
+}
+
+// trash moves root/elems... to the trash as part of the delete batch batchID and reports
+// the outcome for the response. fileID is the video or material ID, depending on kind.
+func (h *DeleteHandler) trash(kind, lessonID, fileID, batchID, root string, elems ...string) models.DeleteItemResult {
+	result := models.DeleteItemResult{Kind: kind}
+	if kind == models.TrashKindVideo {
+		result.VideoID = fileID
+	} else {
+		result.MaterialID = fileID
+	}
+
+	path, err := utils.SafeJoin(root, elems...)
+	if err != nil {
+		log.Printf("Refusing to delete %v under %s: %v", elems, root, err)
+		result.Status = models.DeleteStatusError
+		result.Error = deleteItemError
+		return result
+	}
+
+	item, err := h.trashSvc.Trash(kind, lessonID, fileID, models.TrashReasonDeleted, batchID, path)
+	switch {
+	case os.IsNotExist(err):
+		result.Status = models.DeleteStatusNotFound
+	case err != nil:
+		log.Printf("Failed to delete %s: %v", path, err)
+		result.Status = models.DeleteStatusError
+		result.Error = deleteItemError
+	default:
+		result.Status = models.DeleteStatusDeleted
+		result.TrashID = item.TrashID
+		result.BytesFreed = item.SizeBytes
+		result.FileCount = item.FileCount
+	}
+	return result
+}
+
+// respondDelete totals the item results and answers with them when anything was deleted: 200 when
+// every existing item was deleted, 207 with status "partial" when some failed, so callers checking
+// only the status code still notice files that are left. When nothing was deleted it answers with
+// the standard error body: 404 when nothing existed, 500 when every existing item failed.
+func respondDelete(c *gin.Context, resp *models.DeleteResponse) {
+	deleted, failed, trashed := 0, 0, false
+	for _, item := range resp.Items {
+		switch item.Status {
+		case models.DeleteStatusDeleted:
+			deleted++
+			trashed = trashed || item.TrashID != ""
+			resp.BytesFreed += item.BytesFreed
+			resp.FileCount += item.FileCount
+		case models.DeleteStatusError:
+			failed++
+		}
+	}
+
+	switch {
+	case deleted == 0 && failed > 0:
+		abortWithError(c, newAPIError(http.StatusInternalServerError, CodeInternal, "failed to delete files"))
+		return
+	case deleted == 0:
+		abortWithError(c, newAPIError(http.StatusNotFound, CodeFileNotFound, "nothing to delete"))
+		return
+	}
+
+	status := http.StatusOK
+	resp.Status = models.DeleteStatusDeleted
+	if failed > 0 {
+		status = http.StatusMultiStatus
+		resp.Status = models.DeleteStatusPartial
+		resp.Message = "some files could not be deleted"
+	}
+	if !trashed {
+		resp.BatchID = "" // Nothing to restore
+	}
+
+	c.JSON(status, resp)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"storage-backend/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondDelete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	deleted := models.DeleteItemResult{Kind: models.TrashKindVideo, Status: models.DeleteStatusDeleted, TrashID: "t1", BytesFreed: 10, FileCount: 2}
+	notFound := models.DeleteItemResult{Kind: models.TrashKindVideo, Status: models.DeleteStatusNotFound}
+	failed := models.DeleteItemResult{Kind: models.TrashKindMaterial, Status: models.DeleteStatusError, Error: deleteItemError}
+
+	cases := []struct {
+		name   string
+		items  []models.DeleteItemResult
+		status int
+		want   string // DeleteResponse status for 200 and 207, error code otherwise
+	}{
+		{"all deleted", []models.DeleteItemResult{deleted, deleted}, http.StatusOK, models.DeleteStatusDeleted},
+		{"some failed", []models.DeleteItemResult{deleted, failed}, http.StatusMultiStatus, models.DeleteStatusPartial},
+		{"nothing existed", []models.DeleteItemResult{notFound}, http.StatusNotFound, CodeFileNotFound},
+		{"every item failed", []models.DeleteItemResult{notFound, failed}, http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, r := gin.CreateTestContext(w)
+		r.Use(ErrorHandler())
+		r.DELETE("/", func(c *gin.Context) {
+			respondDelete(c, &models.DeleteResponse{LessonID: "lesson", BatchID: "batch", Items: tc.items})
+		})
+		c.Request = httptest.NewRequest(http.MethodDelete, "/", nil)
+		r.HandleContext(c)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK && tc.status != http.StatusMultiStatus {
+			var body ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != tc.want || body.Error == "" {
+				t.Errorf("%s: body = %s, want an error response with code %q", tc.name, w.Body.String(), tc.want)
+			}
+			continue
+		}
+		var body models.DeleteResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if body.Status != tc.want || len(body.Items) != len(tc.items) || body.BatchID != "batch" {
+			t.Errorf("%s: body = %+v, want status %q with every item and the batch", tc.name, body, tc.want)
+		}
+	}
+}
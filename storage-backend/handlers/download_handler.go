@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"storage-backend/config"
+	"storage-backend/services"
+	"storage-backend/utils"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadHandler serves stored files directly for deployments without nginx.
+// Range/multi-range, If-None-Match, If-Range and If-Modified-Since are handled by http.ServeContent.
+type DownloadHandler struct {
+	fileSvc *services.FileService
+	authSvc *services.AuthService
+	signer  *services.URLSigner
+	cfg     *config.Config
+}
+
+// NewDownloadHandler creates a new download handler
+func NewDownloadHandler(fileSvc *services.FileService, authSvc *services.AuthService, signer *services.URLSigner, cfg *config.Config) *DownloadHandler {
+	return &DownloadHandler{fileSvc: fileSvc, authSvc: authSvc, signer: signer, cfg: cfg}
+}
+
+// ServeVideo handles GET /files/videos/:lesson_id/:video_id (the current version) and the legacy
+// GET /files/videos/:lesson_id for videos stored before per-video IDs
+func (h *DownloadHandler) ServeVideo(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	videoID := c.Param("video_id")
+	if !validID(h.cfg, lessonID) || (videoID != "" && !validFileID(videoID)) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id or video_id"))
+		return
+	}
+
+	// Serve the version the video currently points at
+	version := 0
+	if videoID != "" {
+		v, err := h.fileSvc.CurrentVideoVersion(lessonID, videoID)
+		if err != nil {
+			abortWithError(c, newAPIError(http.StatusNotFound, CodeFileNotFound, "file not found"))
+			return
+		}
+		version = v
+	}
+
+	publicPath := services.VideoPublicPath(lessonID, videoID, version)
+	path, err := utils.SafeJoin(h.cfg.VideosDir, strings.TrimPrefix(publicPath, "/videos/"))
+	if err != nil {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id or video_id"))
+		return
+	}
+
+	h.serveFile(c, lessonID, publicPath, path, services.VideoFilename, "inline")
+}
+
+// ServeMaterial handles GET /files/materials/:lesson_id/:material_id/:filename
+func (h *DownloadHandler) ServeMaterial(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	materialID := c.Param("material_id")
+	filename := c.Param("filename")
+	if !validID(h.cfg, lessonID) || !validFileID(materialID) || !validFilename(filename) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id, material_id or filename"))
+		return
+	}
+
+	publicPath := fmt.Sprintf("/materials/%s/%s/%s", lessonID, materialID, filename)
+	path, err := utils.SafeJoin(h.cfg.MaterialsDir, lessonID, materialID, filename)
+	if err != nil {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id, material_id or filename"))
+		return
+	}
+
+	h.serveFile(c, lessonID, publicPath, path, filename, "attachment")
+}
+
+// serveFile checks access when FILES_REQUIRE_AUTH is on, and for clear video files while
+// HLS_ENCRYPTION is on (see AuthorizeClearMedia), then serves the file at path
+func (h *DownloadHandler) serveFile(c *gin.Context, lessonID, publicPath, path, filename, disposition string) {
+	if h.cfg.FilesRequireAuth || clearMediaNeedsAccess(h.cfg, publicPath) {
+		if status := mediaAccessStatus(c, h.authSvc, h.signer, h.cfg, publicPath, c.Request.URL.Query(), lessonID); status != http.StatusOK {
+			abortWithError(c, newAPIError(status, CodeAccessDenied, http.StatusText(status)))
+			return
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		abortWithError(c, newAPIError(http.StatusNotFound, CodeFileNotFound, "file not found"))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		abortWithError(c, newAPIError(http.StatusNotFound, CodeFileNotFound, "file not found"))
+		return
+	}
+
+	contentType := h.fileSvc.ContentType(path, filename)
+
+	var etag string
+	if meta, err := services.ReadMetadata(path); err == nil && meta.Hash != "" {
+		etag = fmt.Sprintf("%q", meta.Hash)
+	} else {
+		// No sidecar: fall back to a weak validator
+		etag = fmt.Sprintf("W/\"%x-%x\"", info.Size(), info.ModTime().UnixNano())
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", etag)
+	c.Header("Content-Disposition", contentDisposition(disposition, filename))
+	c.Header("Cache-Control", "private, must-revalidate")
+
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime(), file)
+}
+
+// contentDisposition builds a header value with an ASCII fallback and an RFC 5987 UTF-8 filename
+func contentDisposition(disposition, filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s",
+		disposition, fallback, rfc5987Escape(filename))
+}
+
+// rfc5987Escape percent-encodes every byte that is not an RFC 5987 attr-char
+func rfc5987Escape(value string) string {
+	const attrChars = "!#$&+-.^_`|~"
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') ||
+			strings.IndexByte(attrChars, ch) >= 0 {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+// validID checks a lesson ID from a request against ID_PATTERN
+func validID(cfg *config.Config, id string) bool {
+	return utils.ValidID(id, cfg.IDPattern)
+}
+
+// validFileID checks a video or material ID from a request. Those are generated here as UUIDs,
+// whatever ID_PATTERN allows for the main backend's lesson IDs.
+func validFileID(id string) bool {
+	return utils.ValidID(id, "")
+}
+
+// validFilename accepts only names that are already in sanitized form
+func validFilename(filename string) bool {
+	sanitized, err := utils.SanitizeFilename(filename)
+	return err == nil && sanitized == filename && !services.IsMetadataFile(filename)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"storage-backend/config"
+	"storage-backend/services"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDownloadClearMediaNeedsAccess(t *testing.T) {
+	const (
+		lesson   = "3f2504e0-4f89-11d3-9a0c-0305e82c3301"
+		material = "7b62f067-0316-4706-b8fe-23363b89e9a6"
+	)
+	gin.SetMode(gin.TestMode)
+
+	base := t.TempDir()
+	videosDir := filepath.Join(base, "videos")
+	materialsDir := filepath.Join(base, "materials")
+	for _, path := range []string{
+		filepath.Join(videosDir, lesson, services.VideoFilename),
+		filepath.Join(materialsDir, lesson, material, "notes.pdf"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		encrypted bool
+		uri       string
+		signed    string // Public path to sign into the query, if any
+		status    int    // Without a token
+	}{
+		{"clear video without encryption", false, "/files/videos/" + lesson, "", http.StatusOK},
+		{"clear video with encryption", true, "/files/videos/" + lesson, "", http.StatusUnauthorized},
+		{"signed clear video with encryption", true, "/files/videos/" + lesson, "/videos/" + lesson + "/" + services.VideoFilename, http.StatusOK},
+		{"signature for another path", true, "/files/videos/" + lesson, "/videos/" + lesson + "/other.mp4", http.StatusUnauthorized},
+		{"material with encryption", true, "/files/materials/" + lesson + "/" + material + "/notes.pdf", "", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		cfg := &config.Config{
+			VideosDir:         videosDir,
+			MaterialsDir:      materialsDir,
+			HLSEncryption:     tc.encrypted,
+			SignedURLsEnabled: true,
+			SignedURLSecret:   "secret",
+			SignedURLTTL:      60,
+		}
+		signer := services.NewURLSigner(cfg)
+		h := NewDownloadHandler(services.NewFileService(cfg), nil, signer, cfg)
+
+		r := gin.New()
+		r.Use(ErrorHandler())
+		r.GET("/files/videos/:lesson_id", h.ServeVideo)
+		r.GET("/files/materials/:lesson_id/:material_id/:filename", h.ServeMaterial)
+
+		uri := tc.uri
+		if tc.signed != "" {
+			signed, err := signer.Sign(services.SignURLOptions{Path: tc.signed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			uri += signed.URL[strings.Index(signed.URL, "?"):]
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, uri, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.status)
+		}
+	}
+}
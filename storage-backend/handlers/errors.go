@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"storage-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned in the "code" field of every error response
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidToken       = "invalid_token"
+	CodeAccessDenied       = "access_denied"
+	CodeLessonNotFound     = "lesson_not_found"
+	CodeAuthUnavailable    = "auth_unavailable"
+	CodeBackendUnavailable = "backend_unavailable"
+	CodeTooManyUploads     = "too_many_uploads"
+	CodeUploadNotFound     = "upload_not_found"
+	CodeInvalidUploadToken = "invalid_upload_token"
+	CodeIncompleteUpload   = "incomplete_upload"
+	CodeUploadRejected     = "upload_rejected"
+	CodeFileNotFound       = "file_not_found"
+	CodeVideoNotFound      = "video_not_found"
+	CodeVersionNotFound    = "version_not_found"
+	CodeMaterialNotFound   = "material_not_found"
+	CodeReplaceUnavailable = "replace_unavailable"
+	CodeKeyNotFound        = "key_not_found"
+	CodeNothingToRestore   = "nothing_to_restore"
+	CodeRestoreConflict    = "restore_conflict"
+	CodeInvalidSignature   = "invalid_signature"
+	CodeSignatureExpired   = "signature_expired"
+	CodeInternal           = "internal_error"
+)
+
+// ErrorResponse is the JSON body of every error response.
+// "error" stays a human-readable message for existing clients; "code" is machine-readable.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// APIError is an error that already knows its HTTP representation
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// errorMapping maps a service sentinel error to its HTTP representation.
+// An empty message means the error's own text is returned.
+type errorMapping struct {
+	target  error
+	status  int
+	code    string
+	message string
+}
+
+var errorMappings = []errorMapping{
+	{services.ErrAuthenticationFailed, http.StatusUnauthorized, CodeInvalidToken, "invalid or expired token"},
+	{services.ErrLessonNotFound, http.StatusNotFound, CodeLessonNotFound, "lesson not found"},
+	{services.ErrAccessDenied, http.StatusForbidden, CodeAccessDenied, "you don't have permission to access this lesson"},
+	{services.ErrAuthUnavailable, http.StatusServiceUnavailable, CodeAuthUnavailable, "failed to verify access"},
+	{services.ErrBackendUnavailable, http.StatusServiceUnavailable, CodeBackendUnavailable, "main backend unavailable"},
+	{services.ErrTooManyUploads, http.StatusTooManyRequests, CodeTooManyUploads, ""},
+	{services.ErrSessionNotFound, http.StatusNotFound, CodeUploadNotFound, "upload not found"},
+	{services.ErrInvalidUploadToken, http.StatusUnauthorized, CodeInvalidUploadToken, "invalid upload token"},
+	{services.ErrIncompleteUpload, http.StatusBadRequest, CodeIncompleteUpload, ""},
+	{services.ErrUploadRejected, http.StatusConflict, CodeUploadRejected, ""},
+	{services.ErrVideoNotFound, http.StatusNotFound, CodeVideoNotFound, "video not found"},
+	{services.ErrVersionNotFound, http.StatusNotFound, CodeVersionNotFound, "video version not found"},
+	{services.ErrMaterialNotFound, http.StatusNotFound, CodeMaterialNotFound, "material not found"},
+	{services.ErrReplaceWithoutTrash, http.StatusConflict, CodeReplaceUnavailable, ""},
+	{services.ErrReplacementTypeMismatch, http.StatusBadRequest, CodeInvalidRequest, ""},
+	{services.ErrKeyNotFound, http.StatusNotFound, CodeKeyNotFound, "encryption key not found"},
+	{services.ErrNothingToRestore, http.StatusNotFound, CodeNothingToRestore, "nothing to restore"},
+	{services.ErrRestoreConflict, http.StatusConflict, CodeRestoreConflict, ""},
+	{services.ErrSignedURLInvalid, http.StatusForbidden, CodeInvalidSignature, "invalid URL signature"},
+	{services.ErrSignedURLExpired, http.StatusForbidden, CodeSignatureExpired, "signed URL expired"},
+}
+
+// ErrorHandler renders the last error attached with c.Error as a consistent JSON error response
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		apiErr := toAPIError(err)
+
+		if apiErr.Status >= http.StatusInternalServerError {
+			log.Printf("❗️%s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+		}
+		if apiErr.Code == CodeTooManyUploads {
+			c.Header("Retry-After", "60")
+		}
+
+		c.JSON(apiErr.Status, ErrorResponse{Error: apiErr.Message, Code: apiErr.Code})
+	}
+}
+
+// abortWithError stops the handler chain and lets ErrorHandler render err
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			message := m.message
+			if message == "" {
+				message = err.Error()
+			}
+			return newAPIError(m.status, m.code, message)
+		}
+	}
+
+	// Unmapped errors carry paths and internals; ErrorHandler logs them, clients get a generic message
+	return newAPIError(http.StatusInternalServerError, CodeInternal, "internal server error")
+}
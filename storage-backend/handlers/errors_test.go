@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"storage-backend/services"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorHandlerHidesInternalErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{"unmapped", fmt.Errorf("open /data/videos/lesson/video.mp4: permission denied"),
+			http.StatusInternalServerError, CodeInternal, "internal server error"},
+		{"mapped sentinel", fmt.Errorf("lookup: %w", services.ErrVideoNotFound),
+			http.StatusNotFound, CodeVideoNotFound, "video not found"},
+		{"explicit API error", newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"),
+			http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, r := gin.CreateTestContext(w)
+		r.Use(ErrorHandler())
+		r.GET("/", func(c *gin.Context) { abortWithError(c, tc.err) })
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		r.HandleContext(c)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.status)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, `"code":"`+tc.code+`"`) || !strings.Contains(body, `"error":"`+tc.message+`"`) {
+			t.Errorf("%s: body = %s, want code %q and message %q", tc.name, body, tc.code, tc.message)
+		}
+		if strings.Contains(body, "/data/") {
+			t.Errorf("%s: body leaks a filesystem path: %s", tc.name, body)
+		}
+	}
+}
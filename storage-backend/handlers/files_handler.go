@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"storage-backend/config"
+	"storage-backend/models"
+	"storage-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FilesHandler exposes what storage-backend has stored so the main backend can reconcile
+type FilesHandler struct {
+	fileSvc *services.FileService
+	cfg     *config.Config
+}
+
+// NewFilesHandler creates a new files handler
+func NewFilesHandler(fileSvc *services.FileService, cfg *config.Config) *FilesHandler {
+	return &FilesHandler{fileSvc: fileSvc, cfg: cfg}
+}
+
+// GetLessonManifest handles GET /internal/files/:lesson_id
+func (h *FilesHandler) GetLessonManifest(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	if !validID(h.cfg, lessonID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"))
+		return
+	}
+
+	if !authorizeInternal(c, h.cfg) {
+		return
+	}
+
+	manifest, err := h.fileSvc.LessonManifest(lessonID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// VerifyLessonFiles handles POST /internal/files/:lesson_id/verify
+// Re-hashes every stored file of the lesson and compares it with its metadata sidecar.
+func (h *FilesHandler) VerifyLessonFiles(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	if !validID(h.cfg, lessonID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"))
+		return
+	}
+
+	if !authorizeInternal(c, h.cfg) {
+		return
+	}
+
+	results, err := h.fileSvc.VerifyIntegrity(lessonID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	healthy := true
+	for _, result := range results {
+		if result.Status != models.IntegrityOK {
+			healthy = false
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lesson_id": lessonID,
+		"healthy":   healthy,
+		"files":     results,
+	})
+}
+
+// RollbackVideo handles POST /internal/files/:lesson_id/videos/:video_id/rollback
+// Body {"version": N} is optional; without it the video goes back to the version before the current one.
+func (h *FilesHandler) RollbackVideo(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	videoID := c.Param("video_id")
+	if !validID(h.cfg, lessonID) || !validFileID(videoID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id or video_id"))
+		return
+	}
+
+	if !authorizeInternal(c, h.cfg) {
+		return
+	}
+
+	var req models.RollbackVideoRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
+			return
+		}
+	}
+	if req.Version < 0 {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "version must be positive"))
+		return
+	}
+
+	video, pointer, err := h.fileSvc.RollbackVideo(lessonID, videoID, req.Version)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lesson_id":        lessonID,
+		"video_id":         videoID,
+		"version":          pointer.Version,
+		"previous_version": pointer.PreviousVersion,
+		"video":            video,
+	})
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"storage-backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeInternal checks the X-Internal-API-Key header used for backend-to-backend calls
+func authorizeInternal(c *gin.Context, cfg *config.Config) bool {
+	apiKey := c.GetHeader("X-Internal-API-Key")
+	if apiKey != cfg.InternalAPIKey {
+		log.Printf("Unauthorized internal request %s %s: invalid API key", c.Request.Method, c.Request.URL.Path)
+		abortWithError(c, newAPIError(http.StatusUnauthorized, CodeUnauthorized, "unauthorized"))
+		return false
+	}
+	return true
+}
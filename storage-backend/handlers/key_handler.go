@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"storage-backend/config"
+	"storage-backend/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyHandler serves the AES-128 keys of encrypted HLS ladders to players
+type KeyHandler struct {
+	keys    *services.HLSKeyStore
+	authSvc *services.AuthService
+	signer  *services.URLSigner
+	cfg     *config.Config
+}
+
+// NewKeyHandler creates a new key handler
+func NewKeyHandler(keys *services.HLSKeyStore, authSvc *services.AuthService, signer *services.URLSigner, cfg *config.Config) *KeyHandler {
+	return &KeyHandler{keys: keys, authSvc: authSvc, signer: signer, cfg: cfg}
+}
+
+// ServeKey handles GET /keys/:lesson_id/:video_id/:version
+// The key is only returned to callers whose token grants access to the lesson, so downloaded
+// segments are useless without authorization. Signed URLs are never issued for /keys/.
+func (h *KeyHandler) ServeKey(c *gin.Context) {
+	lessonID := c.Param("lesson_id")
+	videoID := c.Param("video_id")
+	version, err := strconv.Atoi(c.Param("version"))
+	if !validID(h.cfg, lessonID) || !validFileID(videoID) || err != nil || version < 1 {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id, video_id or version"))
+		return
+	}
+
+	if status := mediaAccessStatus(c, h.authSvc, h.signer, h.cfg, c.Request.URL.Path, c.Request.URL.Query(), lessonID); status != http.StatusOK {
+		abortWithError(c, newAPIError(status, CodeAccessDenied, http.StatusText(status)))
+		return
+	}
+
+	key, err := h.keys.Read(lessonID, videoID, version)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// Keys must never end up in shared caches
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "application/octet-stream", key)
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bearerToken returns the caller's token from the Authorization header
+// (with or without the "Bearer " prefix), falling back to cookieName when set.
+func bearerToken(c *gin.Context, cookieName string) string {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		return strings.TrimPrefix(authHeader, "Bearer ")
+	}
+
+	if cookieName != "" {
+		if token, err := c.Cookie(cookieName); err == nil {
+			return token
+		}
+	}
+
+	return ""
+}
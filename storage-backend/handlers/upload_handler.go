@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"storage-backend/config"
 	"storage-backend/models"
 	"storage-backend/services"
+	"storage-backend/utils"
 	"strconv"
 	"strings"
 	"sync"
@@ -48,63 +51,80 @@ func NewUploadHandler(uploadSvc *services.UploadService, mergeSvc *services.Merg
 	}
 }
 
+// validateInitRequest rejects lesson, video and material IDs that do not match ID_PATTERN and
+// replaces the client filename with its sanitized form
+func (h *UploadHandler) validateInitRequest(c *gin.Context, req *models.InitUploadRequest) bool {
+	if !validID(h.cfg, req.LessonID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid lesson_id"))
+		return false
+	}
+	if req.VideoID != "" && !validFileID(req.VideoID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid video_id"))
+		return false
+	}
+	if req.MaterialID != "" && !validFileID(req.MaterialID) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid material_id"))
+		return false
+	}
+
+	filename, err := utils.SanitizeFilename(req.Filename)
+	if err != nil || services.IsMetadataFile(filename) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid filename"))
+		return false
+	}
+	req.Filename = filename
+
+	return true
+}
+
+// verifyLessonAccess checks the caller's bearer token against the lesson and
+// records the caller as the uploader. It renders the error response and
+// returns false when access is not granted.
+func (h *UploadHandler) verifyLessonAccess(c *gin.Context, req *models.InitUploadRequest) bool {
+	lessonID := req.LessonID
+
+	token := bearerToken(c, "")
+	if token == "" {
+		abortWithError(c, newAPIError(http.StatusUnauthorized, CodeUnauthorized, "authorization header required"))
+		return false
+	}
+
+	if err := h.authSvc.VerifyLessonAccess(token, lessonID); err != nil {
+		abortWithError(c, err)
+		return false
+	}
+
+	req.UploaderID = h.authSvc.UploaderIdentity(token)
+	return true
+}
+
 // InitVideoUpload handles POST /uploads/videos
 func (h *UploadHandler) InitVideoUpload(c *gin.Context) {
 	var req models.InitUploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
 		return
 	}
 
-	// Validate JWT token with main backend
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
-		return
-	}
-
-	// Extract token (strip "Bearer " prefix if present)
-	token := authHeader
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		token = authHeader[7:]
-	}
-
-	// Verify lesson access with main backend
-	if err := h.authSvc.VerifyLessonAccess(token, req.LessonID); err != nil {
-		errMsg := err.Error()
-		switch {
-		case strings.HasPrefix(errMsg, "authentication failed"):
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-		case errMsg == "lesson not found":
-			c.JSON(http.StatusNotFound, gin.H{"error": "lesson not found"})
-		case errMsg == "user does not have access to this lesson":
-			c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to upload to this lesson"})
-		default:
-			log.Printf("❗️Unexpected auth verification error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify access"})
-		}
+	if !h.validateInitRequest(c, &req) || !h.verifyLessonAccess(c, &req) {
 		return
 	}
 
 	// Set default content type if not provided
 	if req.ContentType == "" {
-		req.ContentType = "video/mp4"
+		req.ContentType = videoContentType(req.Filename)
 	}
 
-	// Validate content type for video
-	if req.ContentType != "video/mp4" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "only video/mp4 is supported"})
+	// Validate content type for video; anything other than MP4 is converted after merge
+	if !h.allowedVideoType(req.ContentType) {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("unsupported video type %q, allowed: %s", req.ContentType, strings.Join(h.cfg.AllowedVideoTypes, ", "))))
 		return
 	}
 
 	session, err := h.uploadSvc.CreateSession(&req, models.TypeVideo)
 	if err != nil {
-		if err.Error() == "too many concurrent uploads, please retry later" {
-			c.Header("Retry-After", "60")
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -118,41 +138,45 @@ func (h *UploadHandler) InitVideoUpload(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// allowedVideoType reports whether contentType (parameters ignored) is in ALLOWED_VIDEO_TYPES
+func (h *UploadHandler) allowedVideoType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range h.cfg.AllowedVideoTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// videoContentType guesses the content type of a video from its extension, defaulting to MP4
+func videoContentType(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mov":
+		return "video/quicktime"
+	case ".webm":
+		return "video/webm"
+	case ".mkv":
+		return "video/x-matroska"
+	case ".avi":
+		return "video/x-msvideo"
+	default:
+		return "video/mp4"
+	}
+}
+
 // InitFileUpload handles POST /uploads/files
 func (h *UploadHandler) InitFileUpload(c *gin.Context) {
 	var req models.InitUploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
 		return
 	}
 
-	// Validate JWT token with main backend
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
-		return
-	}
-
-	// Extract token (strip "Bearer " prefix if present)
-	token := authHeader
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		token = authHeader[7:]
-	}
-
-	// Verify lesson access with main backend
-	if err := h.authSvc.VerifyLessonAccess(token, req.LessonID); err != nil {
-		errMsg := err.Error()
-		switch {
-		case strings.HasPrefix(errMsg, "authentication failed"):
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-		case errMsg == "lesson not found":
-			c.JSON(http.StatusNotFound, gin.H{"error": "lesson not found"})
-		case errMsg == "user does not have access to this lesson":
-			c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to upload to this lesson"})
-		default:
-			log.Printf("❗️Unexpected auth verification error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify access"})
-		}
+	if !h.validateInitRequest(c, &req) || !h.verifyLessonAccess(c, &req) {
 		return
 	}
 
@@ -167,12 +191,7 @@ func (h *UploadHandler) InitFileUpload(c *gin.Context) {
 
 	session, err := h.uploadSvc.CreateSession(&req, models.TypeMaterial)
 	if err != nil {
-		if err.Error() == "too many concurrent uploads, please retry later" {
-			c.Header("Retry-After", "60")
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
@@ -186,6 +205,76 @@ func (h *UploadHandler) InitFileUpload(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// InitCaptionUpload handles POST /uploads/captions
+// Uploads SRT or WebVTT captions (or a timed transcript) of an existing video in one language;
+// a second upload in the same language replaces the track
+func (h *UploadHandler) InitCaptionUpload(c *gin.Context) {
+	var req models.InitUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	if !h.validateInitRequest(c, &req) {
+		return
+	}
+	if req.VideoID == "" {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "video_id is required for captions"))
+		return
+	}
+	language, ok := services.NormalizeCaptionLanguage(req.Language)
+	if !ok {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid language, expected a tag such as \"en\" or \"pt-BR\""))
+		return
+	}
+	req.Language = language
+
+	// Captions are converted in memory after merge, so keep them small
+	if req.Size <= 0 || req.Size > h.cfg.CaptionMaxBytes {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest,
+			fmt.Sprintf("caption files must be between 1 and %d bytes", h.cfg.CaptionMaxBytes)))
+		return
+	}
+
+	contentType, ok := captionContentType(req.Filename)
+	if !ok {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "captions must be an .srt or .vtt file"))
+		return
+	}
+	req.ContentType = contentType
+
+	if !h.verifyLessonAccess(c, &req) {
+		return
+	}
+
+	session, err := h.uploadSvc.CreateSession(&req, models.TypeCaption)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	response := models.InitUploadResponse{
+		UploadID:    session.UploadID,
+		UploadToken: session.UploadToken,
+		ChunkSize:   16777216, // 16MB
+		PutURL:      fmt.Sprintf("/uploads/%s/parts/{n}", session.UploadID),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// captionContentType returns the content type of a caption file from its extension
+func captionContentType(filename string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".srt":
+		return "application/x-subrip", true
+	case ".vtt":
+		return services.CaptionContentType, true
+	default:
+		return "", false
+	}
+}
+
 // UploadPart handles PUT /uploads/:upload_id/parts/:part_num
 func (h *UploadHandler) UploadPart(c *gin.Context) {
 	uploadID := c.Param("upload_id")
@@ -193,19 +282,19 @@ func (h *UploadHandler) UploadPart(c *gin.Context) {
 
 	partNum, err := strconv.Atoi(partNumStr)
 	if err != nil || partNum < 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid part number"})
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "invalid part number"))
 		return
 	}
 
 	uploadToken := c.GetHeader("X-Upload-Token")
 	if uploadToken == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing upload token"})
+		abortWithError(c, newAPIError(http.StatusUnauthorized, CodeInvalidUploadToken, "missing upload token"))
 		return
 	}
 
 	// Validate token BEFORE reading body (fast path)
 	if err := h.uploadSvc.ValidateToken(uploadID, uploadToken); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid upload token"})
+		abortWithError(c, services.ErrInvalidUploadToken)
 		return
 	}
 
@@ -222,7 +311,7 @@ func (h *UploadHandler) UploadPart(c *gin.Context) {
 	n, err := io.CopyBuffer(&bodyBuf, io.LimitReader(c.Request.Body, int64(bufferSize)), buf[:copyBufSize])
 	if err != nil {
 		log.Printf("Failed to read body for upload %s part %d: %v", uploadID[:8], partNum, err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, "failed to read request body"))
 		return
 	}
 
@@ -234,7 +323,7 @@ func (h *UploadHandler) UploadPart(c *gin.Context) {
 	// Save part (this will be async in the service)
 	if err := h.uploadSvc.SavePart(uploadID, partNum, data); err != nil {
 		log.Printf("❌ Failed to save part %d for upload %s: %v", partNum, uploadID[:8], err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save part"})
+		abortWithError(c, newAPIError(http.StatusInternalServerError, CodeInternal, "failed to save part"))
 		return
 	}
 
@@ -248,26 +337,32 @@ func (h *UploadHandler) CompleteUpload(c *gin.Context) {
 
 	uploadToken := c.GetHeader("X-Upload-Token")
 	if uploadToken == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing upload token"})
+		abortWithError(c, newAPIError(http.StatusUnauthorized, CodeInvalidUploadToken, "missing upload token"))
 		return
 	}
 
 	// Validate token
 	if err := h.uploadSvc.ValidateToken(uploadID, uploadToken); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid upload token"})
+		abortWithError(c, services.ErrInvalidUploadToken)
 		return
 	}
 
 	// Mark complete
-	if err := h.uploadSvc.MarkComplete(uploadID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	queued, status, err := h.uploadSvc.MarkComplete(uploadID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if !queued {
+		// A repeated complete: the merge is already queued, running or done
+		c.JSON(http.StatusOK, models.CompleteUploadResponse{Status: string(status)})
 		return
 	}
 
 	// Get session for merge job
 	session, err := h.uploadSvc.GetSession(uploadID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get session"})
+		abortWithError(c, newAPIError(http.StatusInternalServerError, CodeInternal, "failed to get session"))
 		return
 	}
 
@@ -286,7 +381,7 @@ func (h *UploadHandler) GetUploadStatus(c *gin.Context) {
 
 	session, err := h.uploadSvc.GetSession(uploadID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+		abortWithError(c, err)
 		return
 	}
 
@@ -302,6 +397,8 @@ func (h *UploadHandler) GetUploadStatus(c *gin.Context) {
 		ExpectedBytes: session.ExpectedSize,
 		Progress:      progress,
 		Error:         session.Error,
+		ErrorCode:     session.ErrorCode,
+		Renditions:    session.Renditions,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -316,26 +413,26 @@ func (h *UploadHandler) GetUploadedParts(c *gin.Context) {
 	// Check upload token for security
 	uploadToken := c.GetHeader("X-Upload-Token")
 	if uploadToken == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing upload token"})
+		abortWithError(c, newAPIError(http.StatusUnauthorized, CodeInvalidUploadToken, "missing upload token"))
 		return
 	}
 
 	// Validate token
 	if err := h.uploadSvc.ValidateToken(uploadID, uploadToken); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid upload token"})
+		abortWithError(c, services.ErrInvalidUploadToken)
 		return
 	}
 
 	// Get uploaded parts
 	uploadedParts, err := h.uploadSvc.GetUploadedParts(uploadID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		abortWithError(c, err)
 		return
 	}
 
 	session, err := h.uploadSvc.GetSession(uploadID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get session"})
+		abortWithError(c, newAPIError(http.StatusInternalServerError, CodeInternal, "failed to get session"))
 		return
 	}
 
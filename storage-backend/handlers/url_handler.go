@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"storage-backend/config"
+	"storage-backend/models"
+	"storage-backend/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// URLHandler mints signed download URLs for the main backend
+type URLHandler struct {
+	signer *services.URLSigner
+	cfg    *config.Config
+}
+
+// NewURLHandler creates a new URL handler
+func NewURLHandler(signer *services.URLSigner, cfg *config.Config) *URLHandler {
+	return &URLHandler{signer: signer, cfg: cfg}
+}
+
+// SignURL handles POST /internal/urls/sign
+func (h *URLHandler) SignURL(c *gin.Context) {
+	if !authorizeInternal(c, h.cfg) {
+		return
+	}
+
+	if !h.signer.Enabled() {
+		abortWithError(c, newAPIError(http.StatusNotImplemented, CodeInvalidRequest, "signed URLs are not enabled"))
+		return
+	}
+
+	var req models.SignURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	signed, err := h.signer.Sign(services.SignURLOptions{
+		Path:     req.Path,
+		TTL:      time.Duration(req.TTLSeconds) * time.Second,
+		UserID:   req.UserID,
+		ClientIP: req.ClientIP,
+	})
+	if err != nil {
+		abortWithError(c, newAPIError(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, signed)
+}
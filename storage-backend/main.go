@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -9,6 +12,7 @@ import (
 	"storage-backend/config"
 	"storage-backend/handlers"
 	"storage-backend/services"
+	"storage-backend/utils"
 	"syscall"
 	"time"
 
@@ -23,11 +27,20 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// One-off commands: storage-backend reconcile [-apply]
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcile(cfg, os.Args[2:])
+		return
+	}
+
 	log.Printf("=== Storage Backend Configuration ===")
 	log.Printf("Server Address: %s", cfg.ServerAddr)
 	log.Printf("Upload Tmp Dir: %s", cfg.UploadTmpDir)
 	log.Printf("Videos Dir: %s", cfg.VideosDir)
 	log.Printf("Materials Dir: %s", cfg.MaterialsDir)
+	log.Printf("Signed URLs: %v (mode=%s)", cfg.SignedURLsEnabled, cfg.SignedURLMode)
+	log.Printf("Trash Retention: %dh", cfg.TrashRetentionHours)
+	log.Printf("Video Validation: %v", cfg.ValidateVideos)
 	log.Printf("=====================================")
 
 	// Create necessary directories
@@ -43,27 +56,76 @@ func main() {
 
 	log.Printf("✓ All directories created successfully")
 
+	if _, err := utils.CompileIDPattern(cfg.IDPattern); err != nil {
+		log.Fatalf("Invalid ID_PATTERN: %v", err)
+	}
+
+	if cfg.JWTLocalVerify && cfg.JWTSecret != "" && !cfg.HS256Enabled() {
+		log.Fatalf("JWT_SECRET is a placeholder value, set a real secret or leave it empty to reject HS256 tokens")
+	}
+
+	// DASH shares unencrypted CMAF segments, which would bypass the HLS key check
+	if cfg.DASHEnabled && cfg.HLSEncryption {
+		log.Fatalf("DASH_ENABLED cannot be combined with HLS_ENCRYPTION: DASH players cannot decrypt AES-128 segments")
+	}
+
+	if cfg.SignedURLsEnabled && cfg.SignedURLSecret == "" {
+		log.Printf("⚠️ SIGNED_URLS_ENABLED is set but SIGNED_URL_SECRET is empty, signed URLs are disabled")
+	}
+
 	// Initialize services
+	backendClient := services.NewBackendClient(cfg)
+	urlSigner := services.NewURLSigner(cfg)
 	uploadService := services.NewUploadService(cfg)
-	mergeService := services.NewMergeService(cfg)
-	authService := services.NewAuthService(cfg)
+	hlsKeyStore := services.NewHLSKeyStore(cfg)
+	trashService := services.NewTrashService(cfg, hlsKeyStore)
+	mergeService := services.NewMergeService(cfg, backendClient, urlSigner, trashService, hlsKeyStore)
+	authService := services.NewAuthService(cfg, backendClient)
+	fileService := services.NewFileService(cfg)
+	reconcileService := services.NewReconcileService(cfg, fileService, backendClient)
 
 	// Start merge worker
 	go mergeService.StartWorker()
 
+	// Start periodic reconciliation with the main backend
+	if cfg.ReconcileIntervalMinutes > 0 {
+		go reconcileService.StartJob(time.Duration(cfg.ReconcileIntervalMinutes)*time.Minute, cfg.ReconcileDryRun)
+	}
+
+	// Permanently delete trash older than the retention period
+	if trashService.Enabled() && cfg.TrashPurgeIntervalMinutes > 0 {
+		go trashService.StartPurgeJob(time.Duration(cfg.TrashPurgeIntervalMinutes) * time.Minute)
+	}
+
 	// Setup router
 	r := gin.Default()
 
+	// Client addresses bind signed URLs, so only nginx may name them; it sets X-Real-IP
+	r.RemoteIPHeaders = []string{"X-Real-IP"}
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS configuration - Allow all origins for development
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "X-Upload-Token", "Content-Length", "Content-Range"}
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "X-Upload-Token", "Content-Length", "Content-Range", "Range", "If-None-Match", "If-Range"}
+	corsConfig.AllowMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.ExposeHeaders = []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag"}
 	r.Use(cors.New(corsConfig))
 
+	// Render errors attached by handlers as consistent JSON
+	r.Use(handlers.ErrorHandler())
+
 	// Initialize handlers
 	uploadHandler := handlers.NewUploadHandler(uploadService, mergeService, authService, cfg)
-	deleteHandler := handlers.NewDeleteHandler(cfg)
+	deleteHandler := handlers.NewDeleteHandler(trashService, cfg)
+	authHandler := handlers.NewAuthHandler(authService, cfg)
+	urlHandler := handlers.NewURLHandler(urlSigner, cfg)
+	authzHandler := handlers.NewAuthzHandler(authService, urlSigner, cfg)
+	downloadHandler := handlers.NewDownloadHandler(fileService, authService, urlSigner, cfg)
+	filesHandler := handlers.NewFilesHandler(fileService, cfg)
+	keyHandler := handlers.NewKeyHandler(hlsKeyStore, authService, urlSigner, cfg)
 
 	// Routes
 	uploads := r.Group("/uploads")
@@ -77,19 +139,57 @@ func main() {
 
 		// File/Material uploads (same flow as video)
 		uploads.POST("/files", uploadHandler.InitFileUpload)
+
+		// Captions/transcripts of an existing video, one track per language
+		uploads.POST("/captions", uploadHandler.InitCaptionUpload)
 	}
 
 	// Internal API for main backend
 	internal := r.Group("/internal")
 	{
+		internal.GET("/files/:lesson_id", filesHandler.GetLessonManifest)
+		internal.POST("/files/:lesson_id/verify", filesHandler.VerifyLessonFiles)
+		internal.POST("/files/:lesson_id/videos/:video_id/rollback", filesHandler.RollbackVideo)
 		internal.DELETE("/files/:lesson_id", deleteHandler.DeleteLessonFiles)
 		internal.DELETE("/files/:lesson_id/video", deleteHandler.DeleteLessonVideo)
+		internal.DELETE("/files/:lesson_id/videos/:video_id", deleteHandler.DeleteVideo)
 		internal.DELETE("/files/:lesson_id/materials/:material_id", deleteHandler.DeleteLessonMaterial)
+		internal.POST("/files/:lesson_id/restore", deleteHandler.RestoreLessonFiles)
+		internal.POST("/files/:lesson_id/videos/:video_id/restore", deleteHandler.RestoreVideo)
+		internal.POST("/files/:lesson_id/materials/:material_id/restore", deleteHandler.RestoreLessonMaterial)
+		internal.GET("/trash", deleteHandler.ListTrash)
+		internal.POST("/trash/:trash_id/restore", deleteHandler.RestoreTrashItem)
+
+		internal.POST("/auth/invalidate", authHandler.InvalidateAccessCache)
+		internal.POST("/urls/sign", urlHandler.SignURL)
+	}
+
+	// Go-served downloads for deployments without nginx
+	files := r.Group("/files")
+	{
+		files.GET("/videos/:lesson_id", downloadHandler.ServeVideo)
+		files.HEAD("/videos/:lesson_id", downloadHandler.ServeVideo)
+		files.GET("/videos/:lesson_id/:video_id", downloadHandler.ServeVideo)
+		files.HEAD("/videos/:lesson_id/:video_id", downloadHandler.ServeVideo)
+		files.GET("/materials/:lesson_id/:material_id/:filename", downloadHandler.ServeMaterial)
+		files.HEAD("/materials/:lesson_id/:material_id/:filename", downloadHandler.ServeMaterial)
 	}
 
+	// AES-128 keys of encrypted HLS ladders, only for callers with lesson access
+	r.GET("/keys/:lesson_id/:video_id/:version", keyHandler.ServeKey)
+
+	// nginx auth_request endpoint for /videos/ and /materials/
+	r.GET("/authz", authzHandler.Authorize)
+	r.GET("/authz/clear-media", authzHandler.AuthorizeClearMedia)
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
+		breaker := backendClient.BreakerStats()
+		status := "ok"
+		if breaker.State != services.CircuitClosed {
+			status = "degraded"
+		}
+		c.JSON(200, gin.H{"status": status, "main_backend": breaker})
 	})
 
 	// Create HTTP server with custom settings for high concurrency
@@ -129,6 +229,29 @@ func main() {
 	log.Println("Server exited")
 }
 
+// runReconcile compares stored lessons with the main backend once and prints the report as JSON
+func runReconcile(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "quarantine orphans instead of only reporting them (default is a dry run)")
+	fs.Parse(args)
+
+	backendClient := services.NewBackendClient(cfg)
+	fileService := services.NewFileService(cfg)
+	reconcileService := services.NewReconcileService(cfg, fileService, backendClient)
+
+	report, err := reconcileService.Run(!*apply)
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
 func loadEnv() {
 	envCandidates := []string{
 		".env",
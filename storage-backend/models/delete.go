@@ -0,0 +1,35 @@
+package models
+
+// Outcomes of deleting one stored item or a whole request
+const (
+	DeleteStatusDeleted  = "deleted"
+	DeleteStatusNotFound = "not_found"
+	DeleteStatusError    = "error"
+	DeleteStatusPartial  = "partial" // Only for DeleteResponse: some items failed
+)
+
+// DeleteItemResult reports what happened to one video or material directory
+type DeleteItemResult struct {
+	Kind       string `json:"kind"` // TrashKindVideo or TrashKindMaterial
+	VideoID    string `json:"video_id,omitempty"`
+	MaterialID string `json:"material_id,omitempty"`
+	Status     string `json:"status"`
+	TrashID    string `json:"trash_id,omitempty"` // Empty when deleted permanently
+	BytesFreed int64  `json:"bytes_freed"`
+	FileCount  int    `json:"file_count"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DeleteResponse is returned by the internal delete endpoints when anything was deleted;
+// otherwise they answer with the standard error body
+type DeleteResponse struct {
+	Message    string             `json:"message"`
+	LessonID   string             `json:"lesson_id"`
+	VideoID    string             `json:"video_id,omitempty"`
+	MaterialID string             `json:"material_id,omitempty"`
+	Status     string             `json:"status"`
+	BatchID    string             `json:"batch_id,omitempty"` // Restores this request's items; empty when nothing went to the trash
+	BytesFreed int64              `json:"bytes_freed"`
+	FileCount  int                `json:"file_count"`
+	Items      []DeleteItemResult `json:"items"`
+}
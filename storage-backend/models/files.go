@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// LessonManifest lists every file stored for a lesson
+type LessonManifest struct {
+	LessonID  string          `json:"lesson_id"`
+	Video     *VideoEntry     `json:"video"` // Most recently uploaded video, kept for older clients
+	Videos    []VideoEntry    `json:"videos"`
+	Materials []MaterialEntry `json:"materials"`
+}
+
+type VideoEntry struct {
+	VideoID           string         `json:"video_id,omitempty"` // Empty for a legacy /videos/<lesson_id>/video.mp4
+	Version           int            `json:"version,omitempty"`  // Version the URL points at
+	Versions          []int          `json:"versions,omitempty"` // All stored versions, oldest first
+	URL               string         `json:"url"`
+	HLSURL            string         `json:"hls_url,omitempty"`
+	DASHURL           string         `json:"dash_url,omitempty"`
+	PosterURL         string         `json:"poster_url,omitempty"`
+	ThumbnailURLs     []string       `json:"thumbnail_urls,omitempty"`
+	SpriteURL         string         `json:"sprite_url,omitempty"`
+	SpriteVTTURL      string         `json:"sprite_vtt_url,omitempty"`
+	Captions          []CaptionTrack `json:"captions,omitempty"`
+	SizeBytes         int64          `json:"size_bytes"`
+	DurationInSeconds int            `json:"duration_in_seconds,omitempty"`
+	Hash              string         `json:"hash,omitempty"`
+	ModifiedAt        time.Time      `json:"modified_at"`
+}
+
+// CaptionTrack is one language of WebVTT captions stored for a video
+type CaptionTrack struct {
+	Language string `json:"language"`
+	URL      string `json:"url"`
+}
+
+type MaterialEntry struct {
+	MaterialID  string    `json:"material_id"`
+	Filename    string    `json:"filename"`
+	URL         string    `json:"url"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ContentType string    `json:"content_type"`
+	Hash        string    `json:"hash,omitempty"`
+	ModifiedAt  time.Time `json:"modified_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "math"
+
+// MediaInfo is what ffprobe reports about a stored video
+type MediaInfo struct {
+	Container       string            `json:"container"` // ffprobe format_name, e.g. "mov,mp4,m4a,3gp,3g2,mj2"
+	DurationSeconds float64           `json:"duration_seconds"`
+	BitRate         int64             `json:"bit_rate,omitempty"` // Overall bits per second
+	Video           *VideoStreamInfo  `json:"video,omitempty"`
+	Audio           []AudioStreamInfo `json:"audio,omitempty"`
+}
+
+type VideoStreamInfo struct {
+	Codec       string  `json:"codec"`
+	Profile     string  `json:"profile,omitempty"`
+	PixelFormat string  `json:"pixel_format,omitempty"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	FrameRate   float64 `json:"frame_rate,omitempty"`
+	BitRate     int64   `json:"bit_rate,omitempty"`
+	Rotation    int     `json:"rotation,omitempty"` // Clockwise degrees players apply: 0, 90, 180 or 270
+}
+
+type AudioStreamInfo struct {
+	Codec         string `json:"codec"`
+	Channels      int    `json:"channels"`
+	ChannelLayout string `json:"channel_layout,omitempty"`
+	SampleRate    int    `json:"sample_rate,omitempty"`
+	BitRate       int64  `json:"bit_rate,omitempty"`
+	Language      string `json:"language,omitempty"`
+}
+
+// DurationInSeconds rounds the duration to whole seconds; a nil MediaInfo has no duration
+func (m *MediaInfo) DurationInSeconds() int {
+	if m == nil || m.DurationSeconds <= 0 {
+		return 0
+	}
+	return int(math.Round(m.DurationSeconds))
+}
+
+// DisplaySize is the frame size players show, with a quarter-turn rotation applied
+func (v *VideoStreamInfo) DisplaySize() (int, int) {
+	if v.Rotation == 90 || v.Rotation == 270 {
+		return v.Height, v.Width
+	}
+	return v.Width, v.Height
+}
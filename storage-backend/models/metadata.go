@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// FileMetadata is the JSON sidecar written next to every finalized file (<file>.meta.json).
+// It is the durable record of the upload once the in-memory session is gone.
+type FileMetadata struct {
+	UploadID          string       `json:"upload_id"`
+	LessonID          string       `json:"lesson_id"`
+	Type              UploadType   `json:"type"`
+	VideoID           string       `json:"video_id,omitempty"`
+	Version           int          `json:"version,omitempty"`
+	MaterialID        string       `json:"material_id,omitempty"`
+	Filename          string       `json:"filename"`
+	ContentType       string       `json:"content_type"`
+	SizeBytes         int64        `json:"size_bytes"`
+	HashAlgorithm     string       `json:"hash_algorithm"`
+	Hash              string       `json:"hash"`
+	DurationInSeconds int          `json:"duration_in_seconds,omitempty"`
+	Media             *MediaInfo   `json:"media,omitempty"`               // Videos only: ffprobe results
+	SourceContentType string       `json:"source_content_type,omitempty"` // Uploaded type when it was converted (videos to MP4, SRT captions to WebVTT)
+	Conversion        string       `json:"conversion,omitempty"`          // Videos only: "remux" or "transcode"
+	HLSPath           string       `json:"hls_path,omitempty"`            // Videos only: public path of the HLS master playlist
+	HLSEncrypted      bool         `json:"hls_encrypted,omitempty"`       // Videos only: segments need a key from GET /keys/...
+	DASHPath          string       `json:"dash_path,omitempty"`           // Videos only: public path of the DASH manifest
+	Images            *VideoImages `json:"images,omitempty"`              // Videos only: poster, thumbnails and scrubbing sprite
+	Language          string       `json:"language,omitempty"`            // Captions only
+	UploaderID        string       `json:"uploader_id,omitempty"`
+	UploadStartedAt   time.Time    `json:"upload_started_at"`
+	UploadedAt        time.Time    `json:"uploaded_at"`
+}
+
+// VideoImages are the public paths of the preview images extracted from a video version
+type VideoImages struct {
+	Poster     string   `json:"poster"`
+	Thumbnails []string `json:"thumbnails,omitempty"`
+	Sprite     string   `json:"sprite,omitempty"`     // Grid of small frames for scrubbing previews
+	SpriteVTT  string   `json:"sprite_vtt,omitempty"` // WebVTT cues mapping time ranges to sprite tiles (#xywh=)
+}
+
+// IntegrityResult is the outcome of re-hashing one stored file against its sidecar
+type IntegrityResult struct {
+	Path         string `json:"path"`
+	Status       string `json:"status"` // ok, mismatch, missing_metadata, error
+	ExpectedHash string `json:"expected_hash,omitempty"`
+	ActualHash   string `json:"actual_hash,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Integrity check statuses
+const (
+	IntegrityOK              = "ok"
+	IntegrityMismatch        = "mismatch"
+	IntegrityMissingMetadata = "missing_metadata"
+	IntegrityError           = "error"
+)
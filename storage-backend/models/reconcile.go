@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// ReconcileRequest is sent to the main backend's POST /internal/storage/reconcile
+type ReconcileRequest struct {
+	LessonIDs []string `json:"lesson_ids"`
+}
+
+// ReconcileResponse tells storage-backend which of the requested lessons are still live.
+// Lessons missing from the response are left untouched.
+type ReconcileResponse struct {
+	Lessons []ReconcileLesson `json:"lessons"`
+}
+
+type ReconcileLesson struct {
+	LessonID string `json:"lesson_id"`
+	Exists   bool   `json:"exists"`
+	HasVideo bool   `json:"has_video"`
+	// VideoIDs lists live videos; when omitted the lesson's videos are reconciled as a whole by HasVideo
+	VideoIDs    []string `json:"video_ids"`
+	MaterialIDs []string `json:"material_ids"`
+}
+
+// Reconcile item kinds
+const (
+	ReconcileKindVideo    = "video"
+	ReconcileKindMaterial = "material"
+)
+
+// ReconcileItem is one file tree that only one side knows about
+type ReconcileItem struct {
+	LessonID   string `json:"lesson_id"`
+	VideoID    string `json:"video_id,omitempty"`
+	MaterialID string `json:"material_id,omitempty"`
+	Kind       string `json:"kind"`
+	Path       string `json:"path,omitempty"`
+	Action     string `json:"action,omitempty"` // reported, quarantined, failed, skipped (changed too recently)
+}
+
+type ReconcileReport struct {
+	DryRun         bool            `json:"dry_run"`
+	StartedAt      time.Time       `json:"started_at"`
+	FinishedAt     time.Time       `json:"finished_at"`
+	LessonsScanned int             `json:"lessons_scanned"`
+	Orphans        []ReconcileItem `json:"orphans"` // On disk but no longer live in the main backend
+	Missing        []ReconcileItem `json:"missing"` // Live in the main backend but not on disk
+	Errors         []string        `json:"errors,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Trash item kinds
+const (
+	TrashKindVideo    = "video"
+	TrashKindMaterial = "material"
+	TrashKindCaption  = "caption" // One caption track of a video; VideoID names the video
+)
+
+// Why an item was moved to the trash
+const (
+	TrashReasonDeleted  = "deleted"
+	TrashReasonReplaced = "replaced" // Superseded by a new upload under the same material ID or caption language, or an old video version past VIDEO_VERSIONS_KEEP
+)
+
+// TrashItem describes one deleted file tree kept in the trash until PurgeAfter
+type TrashItem struct {
+	TrashID      string    `json:"trash_id"`
+	Kind         string    `json:"kind"`
+	LessonID     string    `json:"lesson_id"`
+	VideoID      string    `json:"video_id,omitempty"`
+	MaterialID   string    `json:"material_id,omitempty"`
+	Reason       string    `json:"reason"`
+	BatchID      string    `json:"batch_id"`      // Shared by the items of one delete request; restores work per batch
+	OriginalPath string    `json:"original_path"` // Relative to the storage base directory
+	SizeBytes    int64     `json:"size_bytes"`
+	FileCount    int       `json:"file_count"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	PurgeAfter   time.Time `json:"purge_after"`
+}
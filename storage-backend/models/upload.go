@@ -5,37 +5,84 @@ import "time"
 type UploadStatus string
 
 const (
-	StatusInitiated UploadStatus = "initiated"
-	StatusReceiving UploadStatus = "receiving"
-	StatusUploaded  UploadStatus = "uploaded"
-	StatusMerging   UploadStatus = "merging"
-	StatusReady     UploadStatus = "ready"
-	StatusFailed    UploadStatus = "failed"
+	StatusInitiated  UploadStatus = "initiated"
+	StatusReceiving  UploadStatus = "receiving"
+	StatusUploaded   UploadStatus = "uploaded"
+	StatusMerging    UploadStatus = "merging"
+	StatusConverting UploadStatus = "converting" // Video is being remuxed or transcoded to MP4
+	StatusPackaging  UploadStatus = "packaging"  // Video is live as MP4, preview images and HLS renditions are being generated
+	StatusReady      UploadStatus = "ready"
+	StatusFailed     UploadStatus = "failed"
 )
 
+// Error codes recorded on a failed session so clients can show a specific message
+const (
+	UploadErrorProcessingFailed  = "processing_failed"
+	UploadErrorNotMP4            = "not_mp4"
+	UploadErrorUnsupportedFormat = "unsupported_format"
+	UploadErrorConversionFailed  = "conversion_failed"
+	UploadErrorNoVideoStream     = "no_video_stream"
+	UploadErrorUnsupportedCodec  = "unsupported_codec"
+	UploadErrorCorruptVideo      = "corrupt_video"
+	UploadErrorInvalidCaptions   = "invalid_captions"
+	UploadErrorSuperseded        = "superseded" // A newer upload of the same video went live first
+)
+
+// Rendition states reported while the HLS ladder is encoded
+const (
+	RenditionPending  = "pending"
+	RenditionEncoding = "encoding"
+	RenditionDone     = "done"
+	RenditionFailed   = "failed"
+)
+
+// Packaging states of a video-ready webhook
+const (
+	PackagingPending  = "pending"  // Preview images and streams follow in a second video-ready webhook
+	PackagingComplete = "complete" // Sent once preview images and streams are generated
+)
+
+// RenditionProgress is the encoding progress of one HLS rendition
+type RenditionProgress struct {
+	Name     string  `json:"name"` // e.g. "720p"
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Status   string  `json:"status"`   // One of the Rendition constants
+	Progress float64 `json:"progress"` // Percent
+	Error    string  `json:"error,omitempty"`
+}
+
 type UploadType string
 
 const (
 	TypeVideo    UploadType = "video"
 	TypeMaterial UploadType = "material"
+	TypeCaption  UploadType = "caption" // Captions or transcript of a video, one file per language
 )
 
 type UploadSession struct {
-	UploadID      string       `json:"upload_id"`
-	LessonID      string       `json:"lesson_id"`
-	Type          UploadType   `json:"type"`
-	Filename      string       `json:"filename"`
-	ContentType   string       `json:"content_type"`
-	ExpectedSize  int64        `json:"expected_size"`
-	ReceivedBytes int64        `json:"received_bytes"`
-	Status        UploadStatus `json:"status"`
-	UploadToken   string       `json:"upload_token"`
-	PartsReceived map[int]bool `json:"-"`
-	TotalParts    int          `json:"total_parts"`
-	CreatedAt     time.Time    `json:"created_at"`
-	CompletedAt   *time.Time   `json:"completed_at,omitempty"`
-	Error         string       `json:"error,omitempty"`
-	OutputPath    string       `json:"output_path,omitempty"`
+	UploadID      string              `json:"upload_id"`
+	LessonID      string              `json:"lesson_id"`
+	Type          UploadType          `json:"type"`
+	Filename      string              `json:"filename"`
+	ContentType   string              `json:"content_type"`
+	ExpectedSize  int64               `json:"expected_size"`
+	ReceivedBytes int64               `json:"received_bytes"`
+	Status        UploadStatus        `json:"status"`
+	UploadToken   string              `json:"upload_token"`
+	PartsReceived map[int]bool        `json:"-"`
+	TotalParts    int                 `json:"total_parts"`
+	CreatedAt     time.Time           `json:"created_at"`
+	CompletedAt   *time.Time          `json:"completed_at,omitempty"`
+	Error         string              `json:"error,omitempty"`
+	ErrorCode     string              `json:"error_code,omitempty"` // One of the UploadError constants
+	Renditions    []RenditionProgress `json:"renditions,omitempty"` // HLS ladder, videos only
+	OutputPath    string              `json:"output_path,omitempty"`
+	ContentHash   string              `json:"content_hash,omitempty"`
+	UploaderID    string              `json:"uploader_id,omitempty"`
+	VideoID       string              `json:"video_id,omitempty"`    // Existing video this upload replaces
+	MaterialID    string              `json:"material_id,omitempty"` // Existing material this upload replaces
+	Language      string              `json:"language,omitempty"`    // Captions only
 }
 
 type InitUploadRequest struct {
@@ -43,6 +90,10 @@ type InitUploadRequest struct {
 	Filename    string `json:"filename" binding:"required"`
 	Size        int64  `json:"size" binding:"required"`
 	ContentType string `json:"content_type"` // Optional - defaults to application/octet-stream if empty
+	VideoID     string `json:"video_id"`     // Optional - replace this existing video with a new version
+	MaterialID  string `json:"material_id"`  // Optional - replace the file of this existing material
+	Language    string `json:"language"`     // Captions only - BCP 47 tag such as "en" or "pt-BR"
+	UploaderID  string `json:"-"`            // Set from the caller's token, never from the request body
 }
 
 type InitUploadResponse struct {
@@ -57,26 +108,95 @@ type CompleteUploadResponse struct {
 }
 
 type UploadStatusResponse struct {
-	UploadID      string       `json:"upload_id"`
-	Status        UploadStatus `json:"status"`
-	ReceivedBytes int64        `json:"received_bytes"`
-	ExpectedBytes int64        `json:"expected_bytes"`
-	Progress      float64      `json:"progress"`
-	Error         string       `json:"error,omitempty"`
+	UploadID      string              `json:"upload_id"`
+	Status        UploadStatus        `json:"status"`
+	ReceivedBytes int64               `json:"received_bytes"`
+	ExpectedBytes int64               `json:"expected_bytes"`
+	Progress      float64             `json:"progress"`
+	Error         string              `json:"error,omitempty"`
+	ErrorCode     string              `json:"error_code,omitempty"`
+	Renditions    []RenditionProgress `json:"renditions,omitempty"`
 }
 
 type VideoReadyWebhook struct {
-	LessonID          string `json:"lesson_id"`
-	VideoURL          string `json:"video_url"`
-	DurationInSeconds int    `json:"duration_in_seconds,omitempty"`
-	TranscriptURL     string `json:"transcript_url,omitempty"`
+	LessonID           string     `json:"lesson_id"`
+	VideoID            string     `json:"video_id"`
+	Version            int        `json:"version"`
+	PreviousVersion    int        `json:"previous_version,omitempty"` // Set when an existing video was replaced
+	VideoURL           string     `json:"video_url"`
+	Packaging          string     `json:"packaging,omitempty"` // One of the Packaging constants, empty when nothing is generated
+	HLSURL             string     `json:"hls_url,omitempty"`   // Master playlist, set when HLS packaging succeeded
+	HLSEncrypted       bool       `json:"hls_encrypted,omitempty"`
+	DASHURL            string     `json:"dash_url,omitempty"` // DASH manifest sharing the HLS renditions' segments
+	PosterURL          string     `json:"poster_url,omitempty"`
+	ThumbnailURLs      []string   `json:"thumbnail_urls,omitempty"`
+	SpriteURL          string     `json:"sprite_url,omitempty"`     // Sprite sheet for scrubbing previews
+	SpriteVTTURL       string     `json:"sprite_vtt_url,omitempty"` // WebVTT index into the sprite sheet
+	DurationInSeconds  int        `json:"duration_in_seconds,omitempty"`
+	Container          string     `json:"container,omitempty"`
+	VideoCodec         string     `json:"video_codec,omitempty"`
+	Width              int        `json:"width,omitempty"`
+	Height             int        `json:"height,omitempty"`
+	FrameRate          float64    `json:"frame_rate,omitempty"`
+	BitRate            int64      `json:"bit_rate,omitempty"`
+	Rotation           int        `json:"rotation,omitempty"`
+	AudioCodec         string     `json:"audio_codec,omitempty"`
+	AudioChannels      int        `json:"audio_channels,omitempty"`
+	TranscriptURL      string     `json:"transcript_url,omitempty"`
+	SignedURL          string     `json:"signed_url,omitempty"`
+	SignedURLExpiresAt *time.Time `json:"signed_url_expires_at,omitempty"`
+}
+
+// SetMedia copies the probed details into the webhook; a nil media leaves them empty
+func (w *VideoReadyWebhook) SetMedia(media *MediaInfo) {
+	if media == nil {
+		return
+	}
+	w.DurationInSeconds = media.DurationInSeconds()
+	w.Container = media.Container
+	w.BitRate = media.BitRate
+	if v := media.Video; v != nil {
+		w.VideoCodec = v.Codec
+		w.Width = v.Width
+		w.Height = v.Height
+		w.FrameRate = v.FrameRate
+		w.Rotation = v.Rotation
+	}
+	if len(media.Audio) > 0 {
+		w.AudioCodec = media.Audio[0].Codec
+		w.AudioChannels = media.Audio[0].Channels
+	}
+}
+
+// CaptionsReadyWebhook is sent when a caption track of a video is added or replaced
+type CaptionsReadyWebhook struct {
+	LessonID      string         `json:"lesson_id"`
+	VideoID       string         `json:"video_id"`
+	Language      string         `json:"language"` // Track added by this upload
+	CaptionURL    string         `json:"caption_url"`
+	Replaced      bool           `json:"replaced,omitempty"`  // A track in this language existed before
+	Converted     bool           `json:"converted,omitempty"` // Uploaded as SRT and converted to WebVTT
+	Captions      []CaptionTrack `json:"captions"`            // Every track now stored for the video
+	TranscriptURL string         `json:"transcript_url,omitempty"`
 }
 
 type FileReadyWebhook struct {
-	LessonID    string `json:"lesson_id"`
-	MaterialID  string `json:"material_id"`
-	FileURL     string `json:"file_url"`
-	Filename    string `json:"filename"`
-	SizeBytes   int64  `json:"size_bytes,omitempty"`
-	ContentType string `json:"content_type,omitempty"`
+	LessonID           string     `json:"lesson_id"`
+	MaterialID         string     `json:"material_id"`
+	FileURL            string     `json:"file_url"`
+	Filename           string     `json:"filename"`
+	SizeBytes          int64      `json:"size_bytes,omitempty"`
+	ContentType        string     `json:"content_type,omitempty"`
+	Replaced           bool       `json:"replaced,omitempty"`          // An existing material was replaced under the same ID
+	PreviousFilename   string     `json:"previous_filename,omitempty"` // Name of the replaced file, kept by the replacement so its URL does not change
+	UploadedFilename   string     `json:"uploaded_filename,omitempty"` // Replacements only: name of the file as uploaded
+	SignedURL          string     `json:"signed_url,omitempty"`
+	SignedURLExpiresAt *time.Time `json:"signed_url_expires_at,omitempty"`
+}
+
+type SignURLRequest struct {
+	Path       string `json:"path" binding:"required"`
+	TTLSeconds int    `json:"ttl_seconds"`
+	UserID     string `json:"user_id"`
+	ClientIP   string `json:"client_ip"`
 }
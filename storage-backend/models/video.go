@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// VideoPointer is the "current version" record of a video, stored as
+// videos/<lesson_id>/<video_id>/current.meta.json and replaced atomically
+type VideoPointer struct {
+	Version         int       `json:"version"`
+	PreviousVersion int       `json:"previous_version,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// RollbackVideoRequest selects the version to switch back to; zero means the one before the current
+type RollbackVideoRequest struct {
+	Version int `json:"version"`
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// accessCacheKey identifies one lesson-access decision.
+// Tokens are hashed so raw credentials never sit in memory longer than needed.
+type accessCacheKey struct {
+	tokenHash string
+	lessonID  string
+}
+
+type accessCacheEntry struct {
+	key       accessCacheKey
+	userID    string // From verified token claims; empty when the token was not verified locally
+	err       error  // nil means access was granted
+	expiresAt time.Time
+}
+
+// accessCache is a bounded LRU cache of lesson-access decisions with
+// separate TTLs for granted and denied results.
+type accessCache struct {
+	mu          sync.Mutex
+	maxEntries  int
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	entries     map[accessCacheKey]*list.Element
+	lru         *list.List
+	generation  uint64 // Bumped by every invalidation
+}
+
+func newAccessCache(maxEntries int, positiveTTL, negativeTTL time.Duration) *accessCache {
+	return &accessCache{
+		maxEntries:  maxEntries,
+		positiveTTL: positiveTTL,
+		negativeTTL: negativeTTL,
+		entries:     make(map[accessCacheKey]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// get returns the cached decision for key, if any
+func (c *accessCache) get(key accessCacheKey) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*accessCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.err, true
+}
+
+// currentGeneration returns the generation an access check starts in; pass it to set
+func (c *accessCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// set stores a decision made by a check that started in generation. A decision from before
+// the last invalidation is dropped, since it may be the grant that was just revoked.
+// notAfter caps the entry lifetime (e.g. token expiry); zero means no cap.
+func (c *accessCache) set(key accessCacheKey, userID string, err error, notAfter time.Time, generation uint64) {
+	ttl := c.positiveTTL
+	if err != nil {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	if !notAfter.IsZero() && notAfter.Before(expiresAt) {
+		expiresAt = notAfter
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*accessCacheEntry)
+		entry.userID = userID
+		entry.err = err
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&accessCacheEntry{
+		key:       key,
+		userID:    userID,
+		err:       err,
+		expiresAt: expiresAt,
+	})
+
+	for c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// invalidate drops cached decisions for a user, a lesson, or both (when both are set,
+// only entries matching both are dropped). Entries without a verified user may belong to
+// anyone, so a user invalidation drops them too. It returns the number of entries removed.
+func (c *accessCache) invalidate(userID, lessonID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	removed := 0
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*accessCacheEntry)
+
+		matches := (userID == "" || entry.userID == userID || entry.userID == "") &&
+			(lessonID == "" || entry.key.lessonID == lessonID)
+		if matches {
+			c.removeElement(elem)
+			removed++
+		}
+
+		elem = next
+	}
+
+	return removed
+}
+
+func (c *accessCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*accessCacheEntry)
+	delete(c.entries, entry.key)
+	c.lru.Remove(elem)
+}
+
+// accessFlight is an in-progress access check shared by concurrent callers
+type accessFlight struct {
+	wg         sync.WaitGroup
+	err        error
+	generation uint64 // Cache generation the check started in
+}
+
+// accessFlightGroup de-duplicates concurrent identical access checks
+type accessFlightGroup struct {
+	mu      sync.Mutex
+	flights map[accessCacheKey]*accessFlight
+}
+
+// do runs fn once per key and cache generation at a time; concurrent callers with the same key
+// wait for and share its result. A caller never joins a flight that started before an invalidation.
+func (g *accessFlightGroup) do(key accessCacheKey, generation uint64, fn func() error) error {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[accessCacheKey]*accessFlight)
+	}
+	if flight, ok := g.flights[key]; ok && flight.generation == generation {
+		g.mu.Unlock()
+		flight.wg.Wait()
+		return flight.err
+	}
+
+	flight := &accessFlight{generation: generation}
+	flight.wg.Add(1)
+	g.flights[key] = flight
+	g.mu.Unlock()
+
+	flight.err = fn()
+	flight.wg.Done()
+
+	g.mu.Lock()
+	if g.flights[key] == flight {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+
+	return flight.err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAccessCacheInvalidation(t *testing.T) {
+	cache := newAccessCache(100, time.Minute, time.Minute)
+	verified := accessCacheKey{tokenHash: "alice-token", lessonID: "lesson-1"}
+	unverified := accessCacheKey{tokenHash: "opaque-token", lessonID: "lesson-1"}
+	otherUser := accessCacheKey{tokenHash: "bob-token", lessonID: "lesson-1"}
+	otherLesson := accessCacheKey{tokenHash: "opaque-token", lessonID: "lesson-2"}
+
+	gen := cache.currentGeneration()
+	cache.set(verified, "alice", nil, time.Time{}, gen)
+	cache.set(unverified, "", nil, time.Time{}, gen)
+	cache.set(otherUser, "bob", nil, time.Time{}, gen)
+	cache.set(otherLesson, "", nil, time.Time{}, gen)
+
+	// Alice's decisions go, and so do those whose user is unknown; Bob's stay
+	if removed := cache.invalidate("alice", "lesson-1"); removed != 2 {
+		t.Errorf("invalidate(alice, lesson-1) removed %d entries, want 2", removed)
+	}
+	for key, want := range map[accessCacheKey]bool{verified: false, unverified: false, otherUser: true, otherLesson: true} {
+		if _, ok := cache.get(key); ok != want {
+			t.Errorf("cached %+v = %v after invalidation, want %v", key, ok, want)
+		}
+	}
+
+	// A check that started before the invalidation must not cache the revoked grant
+	cache.set(verified, "alice", nil, time.Time{}, gen)
+	if _, ok := cache.get(verified); ok {
+		t.Error("decision from before the invalidation was cached")
+	}
+	cache.set(verified, "alice", nil, time.Time{}, cache.currentGeneration())
+	if _, ok := cache.get(verified); !ok {
+		t.Error("decision from after the invalidation was not cached")
+	}
+}
+
+func TestAccessFlightGroupSkipsStaleFlights(t *testing.T) {
+	var group accessFlightGroup
+	key := accessCacheKey{tokenHash: "token", lessonID: "lesson"}
+	revoked := errors.New("revoked")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	stale := make(chan error)
+	go func() {
+		stale <- group.do(key, 0, func() error {
+			close(started)
+			<-release
+			return nil // The grant as it was before the invalidation
+		})
+	}()
+	<-started
+
+	// A caller after an invalidation runs its own check instead of joining the old flight
+	if err := group.do(key, 1, func() error { return revoked }); err != revoked {
+		t.Errorf("do after invalidation = %v, want its own result %v", err, revoked)
+	}
+	close(release)
+	if err := <-stale; err != nil {
+		t.Errorf("stale flight = %v, want nil", err)
+	}
+}
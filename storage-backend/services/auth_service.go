@@ -1,10 +1,9 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"storage-backend/config"
@@ -12,19 +11,137 @@ import (
 )
 
 type AuthService struct {
-	cfg *config.Config
+	cfg      *config.Config
+	backend  *BackendClient
+	verifier *JWTVerifier
+	cache    *accessCache
+	flights  accessFlightGroup
 }
 
-func NewAuthService(cfg *config.Config) *AuthService {
-	return &AuthService{cfg: cfg}
+func NewAuthService(cfg *config.Config, backend *BackendClient) *AuthService {
+	svc := &AuthService{cfg: cfg, backend: backend}
+	if cfg.JWTLocalVerify {
+		svc.verifier = NewJWTVerifier(cfg)
+		log.Printf("🔐 Local JWT verification enabled")
+	}
+	if cfg.AuthCacheSize > 0 {
+		svc.cache = newAccessCache(
+			cfg.AuthCacheSize,
+			time.Duration(cfg.AuthCachePositiveTTL)*time.Second,
+			time.Duration(cfg.AuthCacheNegativeTTL)*time.Second,
+		)
+		log.Printf("🗃️ Lesson access cache enabled (size=%d, positive_ttl=%ds, negative_ttl=%ds)",
+			cfg.AuthCacheSize, cfg.AuthCachePositiveTTL, cfg.AuthCacheNegativeTTL)
+	}
+	return svc
 }
 
-// VerifyLessonAccess calls main-backend internal API to verify user has access to lesson
+// VerifyLessonAccess checks that the user behind authToken may access the lesson.
+// Decisions are cached per (token, lesson) and concurrent identical checks share
+// a single upstream call.
 // authToken is the JWT token from Authorization header (without "Bearer " prefix)
 // lessonID is the lesson UUID string
 func (a *AuthService) VerifyLessonAccess(authToken, lessonID string) error {
-	url := fmt.Sprintf("%s/internal/auth/verify-lesson-access", a.cfg.MainBackendURL)
+	if a.cache == nil {
+		_, err := a.checkLessonAccess(authToken, lessonID)
+		return err
+	}
+
+	key := accessCacheKey{tokenHash: hashToken(authToken), lessonID: lessonID}
+	if err, ok := a.cache.get(key); ok {
+		return err
+	}
 
+	// Taken before the check so a decision that races an invalidation is not cached
+	generation := a.cache.currentGeneration()
+	return a.flights.do(key, generation, func() error {
+		// Another flight may have filled the cache while we were waiting for the lock
+		if err, ok := a.cache.get(key); ok {
+			return err
+		}
+
+		verified, err := a.checkLessonAccess(authToken, lessonID)
+		if err != nil && !isAccessDecision(err) {
+			// Transient failures (network, 5xx) must not be cached
+			return err
+		}
+
+		// Only verified claims name the user an invalidation can target; an unverified
+		// expiry may still shorten the entry, since that only costs its own cache hits
+		var userID string
+		claims := verified
+		if claims != nil {
+			userID = claims.Subject
+		} else {
+			claims = peekTokenClaims(authToken)
+		}
+		var notAfter time.Time
+		if claims != nil && claims.ExpiresAt != 0 {
+			notAfter = time.Unix(claims.ExpiresAt, 0)
+		}
+		a.cache.set(key, userID, err, notAfter, generation)
+
+		return err
+	})
+}
+
+// InvalidateAccess drops cached access decisions for a user and/or lesson, including decisions on
+// tokens whose user was not verified, and keeps checks already in flight from caching their result.
+// It returns the number of cached decisions removed.
+func (a *AuthService) InvalidateAccess(userID, lessonID string) int {
+	if a.cache == nil {
+		return 0
+	}
+
+	removed := a.cache.invalidate(userID, lessonID)
+	log.Printf("🗑️ Invalidated %d cached access decision(s). user_id=%s lesson_id=%s", removed, userID, lessonID)
+	return removed
+}
+
+// UploaderIdentity returns the user ID ("sub") of a token that already passed VerifyLessonAccess,
+// for file metadata. Only a signature checked by local verification can vouch for the subject;
+// with remote verification the main backend does not name the user, so the uploader stays empty.
+func (a *AuthService) UploaderIdentity(authToken string) string {
+	if a.verifier == nil {
+		return ""
+	}
+	claims, err := a.verifier.Verify(authToken)
+	if err != nil {
+		return ""
+	}
+	return claims.Subject
+}
+
+// checkLessonAccess performs the uncached access check.
+// With local verification enabled the token is validated here and its lesson
+// claims (or upload grant) decide access; the main backend is only asked when
+// the token carries no lesson claims. It returns the token's claims when they
+// were verified locally, nil otherwise.
+func (a *AuthService) checkLessonAccess(authToken, lessonID string) (*TokenClaims, error) {
+	if a.verifier == nil {
+		return nil, a.verifyRemote(authToken, lessonID)
+	}
+
+	claims, err := a.verifier.Verify(authToken)
+	if err != nil {
+		log.Printf("🔐 Local token verification failed. lesson_id=%s err=%v", lessonID, err)
+		return nil, fmt.Errorf("%w: %v", ErrAuthenticationFailed, err)
+	}
+
+	if claims.HasLessonClaims() {
+		if !claims.AllowsLesson(lessonID) {
+			log.Printf("🚫 Access denied by token claims. lesson_id=%s sub=%s", lessonID, claims.Subject)
+			return claims, ErrAccessDenied
+		}
+		log.Printf("✅ Auth verified locally from token claims. lesson_id=%s sub=%s", lessonID, claims.Subject)
+		return claims, nil
+	}
+
+	return claims, a.verifyRemote(authToken, lessonID)
+}
+
+// verifyRemote calls main-backend internal API to verify user has access to lesson
+func (a *AuthService) verifyRemote(authToken, lessonID string) error {
 	payload := map[string]string{
 		"lesson_id": lessonID,
 	}
@@ -34,43 +151,53 @@ func (a *AuthService) VerifyLessonAccess(authToken, lessonID string) error {
 		return fmt.Errorf("failed to marshal auth request: %w", err)
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create auth request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authToken))
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", fmt.Sprintf("Bearer %s", authToken))
 
-	resp, err := client.Do(req)
+	// The access check is read-only, so it is safe to retry, but a user is waiting on it:
+	// retries only happen within BACKEND_AUTH_TIMEOUT, never after a timed out attempt
+	timeout := time.Duration(a.cfg.BackendAuthTimeout) * time.Second
+	resp, err := a.backend.Do(BackendRequest{
+		Method:     http.MethodPost,
+		Path:       "/internal/auth/verify-lesson-access",
+		Body:       jsonData,
+		Header:     header,
+		Timeout:    timeout,
+		Deadline:   time.Now().Add(timeout),
+		Idempotent: true,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to call main-backend auth: %w", err)
+		return fmt.Errorf("%w: failed to call main-backend auth: %v", ErrAuthUnavailable, err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode == 401 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("🔐 Auth verification failed (401). lesson_id=%s body=%s", lessonID, string(body))
-		return fmt.Errorf("authentication failed: %s", string(body))
+		log.Printf("🔐 Auth verification failed (401). lesson_id=%s body=%s", lessonID, string(resp.Body))
+		return fmt.Errorf("%w: %s", ErrAuthenticationFailed, string(resp.Body))
 	}
 
 	if resp.StatusCode == 404 {
 		log.Printf("🔍 Lesson not found during auth verification. lesson_id=%s", lessonID)
-		return fmt.Errorf("lesson not found")
+		return ErrLessonNotFound
 	}
 
 	if resp.StatusCode == 403 {
 		log.Printf("🚫 Access denied during auth verification. lesson_id=%s", lessonID)
-		return fmt.Errorf("user does not have access to this lesson")
+		return ErrAccessDenied
 	}
 
 	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("⚠️ Unexpected auth response. status=%d lesson_id=%s body=%s", resp.StatusCode, lessonID, string(body))
-		return fmt.Errorf("auth check failed with status %d: %s", resp.StatusCode, string(body))
+		log.Printf("⚠️ Unexpected auth response. status=%d lesson_id=%s body=%s", resp.StatusCode, lessonID, string(resp.Body))
+		return fmt.Errorf("%w: auth check failed with status %d: %s", ErrAuthUnavailable, resp.StatusCode, string(resp.Body))
 	}
 
 	log.Printf("✅ Auth verification succeeded. lesson_id=%s", lessonID)
 	return nil
 }
+
+// isAccessDecision reports whether err is a definitive answer (401/403/404) rather than a transient failure
+func isAccessDecision(err error) bool {
+	return errors.Is(err, ErrAuthenticationFailed) ||
+		errors.Is(err, ErrLessonNotFound) ||
+		errors.Is(err, ErrAccessDenied)
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"storage-backend/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendRequest describes one call to the main backend
+type BackendRequest struct {
+	Method  string
+	Path    string // Path relative to MAIN_BACKEND_URL, e.g. "/internal/storage/video-ready"
+	Body    []byte
+	Header  http.Header
+	Timeout time.Duration // Per-attempt timeout for this endpoint
+	// Deadline bounds all attempts and backoffs together; a retry that cannot finish by then is not made.
+	// Zero leaves the call to its attempts and per-attempt timeout.
+	Deadline time.Time
+	// Idempotent calls are retried on network errors and 502/503/504
+	Idempotent bool
+}
+
+// BackendResponse is a fully-read main backend response
+type BackendResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// BackendClient is the shared HTTP client for all main-backend traffic.
+// It pools connections, applies per-endpoint timeouts, retries idempotent
+// calls and trips a circuit breaker when the main backend keeps failing.
+type BackendClient struct {
+	cfg     *config.Config
+	client  *http.Client
+	breaker *circuitBreaker
+}
+
+func NewBackendClient(cfg *config.Config) *BackendClient {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.BackendMaxIdleConns,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &BackendClient{
+		cfg:    cfg,
+		client: &http.Client{Transport: transport},
+		breaker: newCircuitBreaker(
+			cfg.BackendBreakerThreshold,
+			time.Duration(cfg.BackendBreakerCooldown)*time.Second,
+		),
+	}
+}
+
+// Do sends req to the main backend, retrying idempotent calls with exponential backoff.
+// The whole call, retries included, counts once towards the circuit breaker: a network error
+// or any 5xx response after the last attempt is one failure.
+func (b *BackendClient) Do(req BackendRequest) (*BackendResponse, error) {
+	url := strings.TrimRight(b.cfg.MainBackendURL, "/") + req.Path
+
+	if !b.breaker.allow() {
+		return nil, fmt.Errorf("%w: circuit open for %s", ErrBackendUnavailable, req.Path)
+	}
+
+	attempts := 1
+	if req.Idempotent {
+		attempts += b.cfg.BackendMaxRetries
+	}
+
+	var (
+		resp *BackendResponse
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		resp, err = b.doOnce(url, req)
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			break
+		}
+		if attempt == attempts {
+			break
+		}
+
+		backoff := retryBackoff(attempt)
+		if !req.Deadline.IsZero() && time.Until(req.Deadline) <= backoff {
+			// No time left for another attempt within the caller's deadline
+			break
+		}
+		log.Printf("↻ Retrying %s %s in %v (attempt %d/%d)", req.Method, req.Path, backoff, attempt+1, attempts)
+		time.Sleep(backoff)
+	}
+
+	if err != nil {
+		b.breaker.recordFailure()
+		return nil, fmt.Errorf("%w: %s %s: %v", ErrBackendUnavailable, req.Method, req.Path, err)
+	}
+	if resp.StatusCode >= 500 {
+		// The 5xx response is still handed to the caller
+		b.breaker.recordFailure()
+	} else {
+		b.breaker.recordSuccess()
+	}
+	return resp, nil
+}
+
+// BreakerStats reports the circuit breaker state for health checks
+func (b *BackendClient) BreakerStats() CircuitStats {
+	return b.breaker.stats()
+}
+
+func (b *BackendClient) doOnce(url string, req BackendRequest) (*BackendResponse, error) {
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	if !req.Deadline.IsZero() {
+		if remaining := time.Until(req.Deadline); remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, url, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.Header {
+		for _, v := range values {
+			httpReq.Header.Add(key, v)
+		}
+	}
+
+	resp, err := b.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackendResponse{StatusCode: resp.StatusCode, Body: body}, nil
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+// retryBackoff returns 200ms, 400ms, 800ms... with up to 50% jitter, capped at 5s
+func retryBackoff(attempt int) time.Duration {
+	backoff := 200 * time.Millisecond << (attempt - 1)
+	if backoff > 5*time.Second {
+		backoff = 5 * time.Second
+	}
+	return backoff + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitStats is the breaker state exposed on /health
+type CircuitStats struct {
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+// circuitBreaker opens after threshold consecutive failures, rejects calls for
+// cooldown, then lets a single probe through (half-open) to decide whether to close.
+type circuitBreaker struct {
+	mu            sync.Mutex
+	threshold     int
+	cooldown      time.Duration
+	state         CircuitState
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     CircuitClosed,
+	}
+}
+
+func (cb *circuitBreaker) allow() bool {
+	if cb.threshold <= 0 {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.probeInFlight = true
+		log.Printf("⚡ Main backend circuit half-open, sending probe request")
+		return true
+	case CircuitHalfOpen:
+		if cb.probeInFlight {
+			return false
+		}
+		cb.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (cb *circuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != CircuitClosed {
+		log.Printf("✅ Main backend circuit closed")
+	}
+	cb.state = CircuitClosed
+	cb.failures = 0
+	cb.probeInFlight = false
+}
+
+func (cb *circuitBreaker) recordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.probeInFlight = false
+
+	if cb.threshold <= 0 {
+		return
+	}
+
+	if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.threshold) {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+		log.Printf("⚡ Main backend circuit opened after %d consecutive failure(s)", cb.failures)
+	}
+}
+
+func (cb *circuitBreaker) stats() CircuitStats {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	stats := CircuitStats{
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+	}
+	if cb.state != CircuitClosed {
+		openedAt := cb.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
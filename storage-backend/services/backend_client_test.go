@@ -0,0 +1,88 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"storage-backend/config"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackendClientRetriesAndBreaker(t *testing.T) {
+	var calls int32
+	status := int32(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	client := NewBackendClient(&config.Config{
+		MainBackendURL:          server.URL,
+		BackendMaxRetries:       2,
+		BackendBreakerThreshold: 3,
+		BackendBreakerCooldown:  60,
+	})
+
+	// Three attempts of one call are a single breaker failure, and the last 503 reaches the caller
+	resp, err := client.Do(BackendRequest{Method: http.MethodPost, Path: "/busy", Idempotent: true})
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Do = %v, %v; want the 503 response", resp, err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+	if stats := client.BreakerStats(); stats.ConsecutiveFailures != 1 || stats.State != CircuitClosed {
+		t.Errorf("breaker after one failed call = %+v, want 1 failure and closed", stats)
+	}
+
+	// A 500 is not retried but still counts as a failure
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	if resp, err := client.Do(BackendRequest{Method: http.MethodPost, Path: "/broken", Idempotent: true}); err != nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Do = %v, %v; want the 500 response", resp, err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("attempts on 500 = %d, want 1", got)
+	}
+	if stats := client.BreakerStats(); stats.ConsecutiveFailures != 2 {
+		t.Errorf("consecutive failures = %d, want 2", stats.ConsecutiveFailures)
+	}
+
+	// A timed out attempt uses up the deadline, so it is not retried
+	atomic.StoreInt32(&calls, 0)
+	start := time.Now()
+	_, err = client.Do(BackendRequest{
+		Method:     http.MethodPost,
+		Path:       "/slow",
+		Timeout:    100 * time.Millisecond,
+		Deadline:   time.Now().Add(150 * time.Millisecond),
+		Idempotent: true,
+	})
+	if err == nil {
+		t.Fatal("Do succeeded against a backend slower than the timeout")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("attempts within the deadline = %d, want 1", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do took %v, want it bounded by the deadline", elapsed)
+	}
+	if stats := client.BreakerStats(); stats.State != CircuitOpen {
+		t.Errorf("breaker after three failed calls = %+v, want open", stats)
+	}
+
+	// Success resets the breaker once it lets a probe through
+	client.breaker.cooldown = 0
+	atomic.StoreInt32(&status, http.StatusOK)
+	if _, err := client.Do(BackendRequest{Method: http.MethodPost, Path: "/ok"}); err != nil {
+		t.Fatalf("probe call failed: %v", err)
+	}
+	if stats := client.BreakerStats(); stats.State != CircuitClosed || stats.ConsecutiveFailures != 0 {
+		t.Errorf("breaker after a successful probe = %+v, want closed", stats)
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"storage-backend/models"
+	"storage-backend/utils"
+	"strings"
+)
+
+// Captions of a video are shared by all its versions, one WebVTT file per language:
+//
+//	videos/<lesson_id>/<video_id>/captions/<language>.vtt
+//
+// A replacement upload usually re-cuts the same script, so tracks are kept when a new
+// version goes live and move to the trash together with the video. A track replaced by a new
+// upload in the same language goes to the trash on its own.
+
+// CaptionsDirName is the directory of a video holding its caption tracks
+const CaptionsDirName = "captions"
+
+// CaptionContentType is the content type of every stored caption track; SRT uploads are converted to it
+const CaptionContentType = "text/vtt"
+
+const captionExt = ".vtt"
+
+// captionLanguage accepts lowercased BCP 47 tags: a 2-3 letter language and optional subtags
+var captionLanguage = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// NormalizeCaptionLanguage lowercases a language tag such as "pt-BR" and reports whether it is well formed
+func NormalizeCaptionLanguage(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return tag, captionLanguage.MatchString(tag)
+}
+
+// CaptionPublicPath returns the public path of a video's caption track
+func CaptionPublicPath(lessonID, videoID, language string) string {
+	return fmt.Sprintf("/videos/%s/%s/%s/%s%s", lessonID, videoID, CaptionsDirName, language, captionExt)
+}
+
+// CaptionValidationError rejects an uploaded caption file; Message is shown to the uploader
+type CaptionValidationError struct {
+	Message string
+}
+
+func (e *CaptionValidationError) Error() string {
+	return "invalid captions: " + e.Message
+}
+
+// storeCaption converts a merged caption upload to WebVTT and stores it as the video's track
+// for the session language, replacing an earlier track in that language
+func (m *MergeService) storeCaption(uploadID string, session *models.UploadSession, src string) (*mergedFile, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captions: %w", err)
+	}
+	vtt, converted, err := utils.ToWebVTT(data)
+	if err != nil {
+		return nil, &CaptionValidationError{Message: err.Error()}
+	}
+
+	// The video may have been deleted while the captions were uploading
+	videoDir, err := utils.SafeJoin(m.cfg.VideosDir, session.LessonID, session.VideoID)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(videoDir); err != nil || !info.IsDir() {
+		return nil, ErrVideoNotFound
+	}
+
+	captionsDir := filepath.Join(videoDir, CaptionsDirName)
+	if err := os.MkdirAll(captionsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create captions directory: %w", err)
+	}
+	finalPath := filepath.Join(captionsDir, session.Language+captionExt)
+
+	// Write next to the target and rename so players never load a partial track
+	staging := filepath.Join(captionsDir, ".upload-"+uploadID)
+	if err := os.WriteFile(staging, vtt, 0644); err != nil {
+		os.Remove(staging)
+		return nil, fmt.Errorf("failed to write captions: %w", err)
+	}
+
+	item, err := m.trash.Trash(models.TrashKindCaption, session.LessonID, session.VideoID, models.TrashReasonReplaced, "", finalPath)
+	if err != nil && !os.IsNotExist(err) {
+		os.Remove(staging)
+		return nil, fmt.Errorf("failed to move replaced captions to trash: %w", err)
+	}
+
+	if err := os.Rename(staging, finalPath); err != nil {
+		os.Remove(staging)
+		if item != nil {
+			if restoreErr := m.trash.Untrash(item); restoreErr != nil {
+				log.Printf("❗️Failed to restore replaced captions %s from trash %s: %v", finalPath, item.TrashID, restoreErr)
+			}
+		}
+		return nil, fmt.Errorf("failed to move captions into place: %w", err)
+	}
+
+	log.Printf("💬 Captions %s for video %s/%s stored (converted from SRT: %v)", session.Language, session.LessonID, session.VideoID, converted)
+
+	sum := sha1.Sum(vtt)
+	return &mergedFile{
+		Path:             finalPath,
+		Hash:             hex.EncodeToString(sum[:]),
+		FileID:           session.VideoID,
+		Replaced:         item != nil,
+		CaptionConverted: converted,
+	}, nil
+}
+
+// captionLanguages lists the languages with a stored track for a video, sorted
+func captionLanguages(videoDir string) []string {
+	entries, err := os.ReadDir(filepath.Join(videoDir, CaptionsDirName))
+	if err != nil {
+		return nil
+	}
+
+	var languages []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, captionExt) {
+			continue
+		}
+		languages = append(languages, strings.TrimSuffix(name, captionExt))
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// captionTracks returns the caption tracks stored for a video with URLs built by publicURL
+func captionTracks(videoDir, lessonID, videoID string, publicURL func(path string) string) []models.CaptionTrack {
+	var tracks []models.CaptionTrack
+	for _, language := range captionLanguages(videoDir) {
+		tracks = append(tracks, models.CaptionTrack{
+			Language: language,
+			URL:      publicURL(CaptionPublicPath(lessonID, videoID, language)),
+		})
+	}
+	return tracks
+}
+
+// transcriptURL picks the track used as a video's transcript: the default language,
+// then a regional variant of it (en-us for en), then the first track
+func transcriptURL(tracks []models.CaptionTrack, defaultLanguage string) string {
+	if len(tracks) == 0 {
+		return ""
+	}
+	for _, track := range tracks {
+		if track.Language == defaultLanguage {
+			return track.URL
+		}
+	}
+	for _, track := range tracks {
+		if strings.HasPrefix(track.Language, defaultLanguage+"-") {
+			return track.URL
+		}
+	}
+	return tracks[0].URL
+}
+
+// captionTracks lists the caption tracks stored for a video with absolute URLs for webhooks
+func (m *MergeService) captionTracks(lessonID, videoID, publicBase string) []models.CaptionTrack {
+	videoDir := filepath.Join(m.cfg.VideosDir, lessonID, videoID)
+	return captionTracks(videoDir, lessonID, videoID, func(path string) string {
+		return publicBase + path
+	})
+}
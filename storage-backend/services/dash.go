@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"storage-backend/models"
+	"strconv"
+)
+
+// CMAFDirName is the directory of a video version holding CMAF segments shared by HLS and DASH
+const CMAFDirName = "cmaf"
+
+// DASHManifest is the DASH manifest inside CMAFDirName
+const DASHManifest = "manifest.mpd"
+
+// encodeCMAFLadder encodes all renditions in a single ffmpeg run with the dash muxer, which writes
+// fragmented MP4 segments once and both a DASH manifest and HLS playlists pointing at them.
+// Video renditions and the audio track are separate representations, as DASH players expect.
+func (m *MergeService) encodeCMAFLadder(uploadID string, merged *mergedFile, ladder []hlsRendition, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	segment := strconv.Itoa(m.cfg.HLSSegmentSeconds)
+	args := []string{"-i", merged.Path, "-filter_complex", ladderScaleFilter(ladder)}
+	for i := range ladder {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+	}
+
+	hasAudio := len(merged.Media.Audio) > 0
+	audioBitrate := ladder[len(ladder)-1].AudioBitrate
+	if hasAudio {
+		args = append(args, "-map", "0:a:0")
+	}
+
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", m.cfg.TranscodePreset,
+		"-profile:v", "main",
+		"-pix_fmt", "yuv420p",
+		"-force_key_frames", "expr:gte(t,n_forced*"+segment+")",
+		"-sc_threshold", "0",
+	)
+	for i, rendition := range ladder {
+		args = append(args,
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+		)
+	}
+
+	adaptationSets := "id=0,streams=v"
+	if hasAudio {
+		args = append(args, "-c:a", "aac", "-b:a", fmt.Sprintf("%dk", audioBitrate), "-ac", "2")
+		adaptationSets += " id=1,streams=a"
+	}
+
+	args = append(args,
+		"-f", "dash",
+		"-seg_duration", segment,
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-adaptation_sets", adaptationSets,
+		// HLS playlists (master.m3u8 and one media playlist per stream) over the same segments
+		"-hls_playlist", "1",
+		filepath.Join(dir, DASHManifest),
+	)
+
+	// Renditions share one encoder run, so they progress together
+	onProgress := m.ladderProgress(uploadID, ladder)
+	onProgress(0)
+
+	if err := m.encodeFFmpegProgress(merged.Media.DurationSeconds, onProgress, args...); err != nil {
+		m.reportLadder(uploadID, ladder, models.RenditionFailed, 0, err.Error())
+		return fmt.Errorf("CMAF ladder: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, HLSMasterPlaylist)); err != nil {
+		m.reportLadder(uploadID, ladder, models.RenditionFailed, 0, "ffmpeg wrote no HLS master playlist")
+		return fmt.Errorf("CMAF ladder: missing %s: %w", HLSMasterPlaylist, err)
+	}
+
+	m.reportLadder(uploadID, ladder, models.RenditionDone, 100, "")
+	return nil
+}
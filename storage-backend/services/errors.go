@@ -0,0 +1,41 @@
+package services
+
+import "errors"
+
+// Sentinel errors returned by services. Wrap them with fmt.Errorf("%w: ...")
+// to add detail; callers should match with errors.Is.
+var (
+	// Main backend
+	ErrBackendUnavailable = errors.New("main backend unavailable")
+
+	// Auth
+	ErrAuthenticationFailed = errors.New("authentication failed")
+	ErrAccessDenied         = errors.New("user does not have access to this lesson")
+	ErrLessonNotFound       = errors.New("lesson not found")
+	ErrAuthUnavailable      = errors.New("failed to verify access")
+
+	// Uploads
+	ErrTooManyUploads     = errors.New("too many concurrent uploads, please retry later")
+	ErrSessionNotFound    = errors.New("upload session not found")
+	ErrInvalidUploadToken = errors.New("invalid upload token")
+	ErrIncompleteUpload   = errors.New("upload is incomplete")
+	ErrUploadRejected     = errors.New("upload was rejected, start a new upload")
+
+	// Stored files
+	ErrVideoNotFound    = errors.New("video not found")
+	ErrVersionNotFound  = errors.New("video version not found")
+	ErrMaterialNotFound = errors.New("material not found")
+	ErrKeyNotFound      = errors.New("encryption key not found")
+
+	// Material replacement
+	ErrReplaceWithoutTrash     = errors.New("materials cannot be replaced while the trash is disabled")
+	ErrReplacementTypeMismatch = errors.New("a replacement must have the same file extension as the material it replaces")
+
+	// Trash
+	ErrNothingToRestore = errors.New("nothing to restore")
+	ErrRestoreConflict  = errors.New("restore target already exists")
+
+	// Signed URLs
+	ErrSignedURLInvalid = errors.New("invalid URL signature")
+	ErrSignedURLExpired = errors.New("signed URL expired")
+)
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"storage-backend/config"
+	"storage-backend/models"
+	"storage-backend/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VideoFilename is the name of every stored video file
+const VideoFilename = "video.mp4"
+
+// VideoContentType is the content type of every stored video; other uploads are converted to it
+const VideoContentType = "video/mp4"
+
+// VideoPublicPath returns the public path of a video version. The version is part
+// of the path so every replacement gets a new URL and caches never serve a stale file.
+// An empty videoID is the legacy single video stored as /videos/<lesson_id>/video.mp4,
+// and version 0 a video stored before versioning.
+func VideoPublicPath(lessonID, videoID string, version int) string {
+	if videoID == "" {
+		return fmt.Sprintf("/videos/%s/%s", lessonID, VideoFilename)
+	}
+	if version == 0 {
+		return fmt.Sprintf("/videos/%s/%s/%s", lessonID, videoID, VideoFilename)
+	}
+	return fmt.Sprintf("/videos/%s/%s/%s/%s", lessonID, videoID, VersionDirName(version), VideoFilename)
+}
+
+// FileService answers questions about files already stored under VideosDir/MaterialsDir.
+// Facts come from each file's metadata sidecar; files without one are inspected directly.
+type FileService struct {
+	cfg *config.Config
+
+	// Hashes and durations are expensive to compute, so remember them per file version
+	statsMu sync.Mutex
+	stats   map[fileStatsKey]fileStats
+}
+
+type fileStatsKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+type fileStats struct {
+	hash     string
+	duration int
+}
+
+func NewFileService(cfg *config.Config) *FileService {
+	return &FileService{
+		cfg:   cfg,
+		stats: make(map[fileStatsKey]fileStats),
+	}
+}
+
+// LessonManifest scans the lesson's video and material directories
+func (f *FileService) LessonManifest(lessonID string) (*models.LessonManifest, error) {
+	manifest := &models.LessonManifest{
+		LessonID:  lessonID,
+		Materials: []models.MaterialEntry{},
+	}
+
+	videoIDs, err := f.VideoIDs(lessonID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read videos directory: %w", err)
+	}
+	if f.HasLegacyVideo(lessonID) {
+		videoIDs = append([]string{""}, videoIDs...)
+	}
+
+	manifest.Videos = []models.VideoEntry{}
+	for _, videoID := range videoIDs {
+		entry, err := f.VideoEntry(lessonID, videoID)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Failed to read video %s/%s: %v", lessonID, videoID, err)
+			}
+			continue
+		}
+		manifest.Videos = append(manifest.Videos, *entry)
+	}
+
+	sort.SliceStable(manifest.Videos, func(i, j int) bool {
+		return manifest.Videos[i].ModifiedAt.Before(manifest.Videos[j].ModifiedAt)
+	})
+	if n := len(manifest.Videos); n > 0 {
+		latest := manifest.Videos[n-1]
+		manifest.Video = &latest
+	}
+
+	lessonMaterialsDir := filepath.Join(f.cfg.MaterialsDir, lessonID)
+	materialDirs, err := os.ReadDir(lessonMaterialsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read materials directory: %w", err)
+	}
+
+	for _, materialDir := range materialDirs {
+		if !materialDir.IsDir() {
+			continue
+		}
+		materialID := materialDir.Name()
+
+		files, err := os.ReadDir(filepath.Join(lessonMaterialsDir, materialID))
+		if err != nil {
+			log.Printf("Failed to read material directory %s/%s: %v", lessonID, materialID, err)
+			continue
+		}
+
+		for _, file := range files {
+			if file.IsDir() || IsMetadataFile(file.Name()) || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+
+			path := filepath.Join(lessonMaterialsDir, materialID, file.Name())
+			stats := f.fileStats(path, info)
+			manifest.Materials = append(manifest.Materials, models.MaterialEntry{
+				MaterialID:  materialID,
+				Filename:    file.Name(),
+				URL:         f.PublicURL(fmt.Sprintf("/materials/%s/%s/%s", lessonID, materialID, file.Name())),
+				SizeBytes:   info.Size(),
+				ContentType: f.ContentType(path, file.Name()),
+				Hash:        stats.hash,
+				ModifiedAt:  info.ModTime(),
+			})
+		}
+	}
+
+	return manifest, nil
+}
+
+// ListLessonIDs returns every lesson ID that has a video or materials directory, sorted
+func (f *FileService) ListLessonIDs() ([]string, error) {
+	seen := make(map[string]bool)
+	for _, root := range []string{f.cfg.VideosDir, f.cfg.MaterialsDir} {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", root, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				seen[entry.Name()] = true
+			}
+		}
+	}
+
+	lessonIDs := make([]string, 0, len(seen))
+	for id := range seen {
+		lessonIDs = append(lessonIDs, id)
+	}
+	sort.Strings(lessonIDs)
+	return lessonIDs, nil
+}
+
+// HasVideo reports whether any video is stored for the lesson
+func (f *FileService) HasVideo(lessonID string) bool {
+	info, err := os.Stat(f.VideoDir(lessonID))
+	return err == nil && info.IsDir()
+}
+
+// HasLegacyVideo reports whether the lesson still has a video stored before per-video IDs
+func (f *FileService) HasLegacyVideo(lessonID string) bool {
+	info, err := os.Stat(f.VideoPath(lessonID, "", 0))
+	return err == nil && !info.IsDir()
+}
+
+// VideoEntry describes the current version of a video; an empty videoID is the legacy video
+func (f *FileService) VideoEntry(lessonID, videoID string) (*models.VideoEntry, error) {
+	version, versions := 0, []int(nil)
+	if videoID != "" {
+		var err error
+		if version, err = f.CurrentVideoVersion(lessonID, videoID); err != nil {
+			return nil, err
+		}
+		if versions, err = listVideoVersions(filepath.Join(f.VideoDir(lessonID), videoID)); err != nil {
+			return nil, err
+		}
+	}
+
+	videoPath := f.VideoPath(lessonID, videoID, version)
+	info, err := os.Stat(videoPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, os.ErrNotExist
+	}
+
+	stats := f.fileStats(videoPath, info)
+	entry := &models.VideoEntry{
+		VideoID:           videoID,
+		Version:           version,
+		Versions:          versions,
+		URL:               f.PublicURL(VideoPublicPath(lessonID, videoID, version)),
+		SizeBytes:         info.Size(),
+		DurationInSeconds: stats.duration,
+		Hash:              stats.hash,
+		ModifiedAt:        info.ModTime(),
+	}
+	if videoID != "" {
+		entry.Captions = captionTracks(filepath.Join(f.VideoDir(lessonID), videoID), lessonID, videoID, f.PublicURL)
+	}
+	if meta, err := ReadMetadata(videoPath); err == nil {
+		if meta.HLSPath != "" {
+			entry.HLSURL = f.PublicURL(meta.HLSPath)
+		}
+		if meta.DASHPath != "" {
+			entry.DASHURL = f.PublicURL(meta.DASHPath)
+		}
+		if images := meta.Images; images != nil {
+			entry.PosterURL = f.PublicURL(images.Poster)
+			for _, thumbnail := range images.Thumbnails {
+				entry.ThumbnailURLs = append(entry.ThumbnailURLs, f.PublicURL(thumbnail))
+			}
+			entry.SpriteURL = f.PublicURL(images.Sprite)
+			entry.SpriteVTTURL = f.PublicURL(images.SpriteVTT)
+		}
+	}
+	return entry, nil
+}
+
+// CurrentVideoVersion returns the version a video currently points at
+func (f *FileService) CurrentVideoVersion(lessonID, videoID string) (int, error) {
+	return currentVideoVersion(filepath.Join(f.VideoDir(lessonID), videoID))
+}
+
+// RollbackVideo points a video back at an earlier version. Version 0 selects the
+// newest version older than the current one.
+func (f *FileService) RollbackVideo(lessonID, videoID string, version int) (*models.VideoEntry, *models.VideoPointer, error) {
+	videoDir, err := utils.SafeJoin(f.cfg.VideosDir, lessonID, videoID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, pointer, err := rollbackVideoVersion(videoDir, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("⏪ Video %s/%s rolled back from v%d to v%d", lessonID, videoID, current, pointer.Version)
+
+	entry, err := f.VideoEntry(lessonID, videoID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, pointer, nil
+}
+
+// VideoIDs returns the video IDs stored for the lesson, not counting a legacy video
+func (f *FileService) VideoIDs(lessonID string) ([]string, error) {
+	return subdirectories(f.VideoDir(lessonID))
+}
+
+// MaterialIDs returns the material IDs stored for the lesson
+func (f *FileService) MaterialIDs(lessonID string) ([]string, error) {
+	return subdirectories(filepath.Join(f.cfg.MaterialsDir, lessonID))
+}
+
+// VideoDir is the directory holding all videos of a lesson
+func (f *FileService) VideoDir(lessonID string) string {
+	return filepath.Join(f.cfg.VideosDir, lessonID)
+}
+
+// VideoPath is where a version of a video is stored; an empty videoID is the legacy video
+func (f *FileService) VideoPath(lessonID, videoID string, version int) string {
+	return versionedVideoPath(filepath.Join(f.VideoDir(lessonID), videoID), version)
+}
+
+// MaterialDir is the directory holding one material of a lesson
+func (f *FileService) MaterialDir(lessonID, materialID string) string {
+	return filepath.Join(f.cfg.MaterialsDir, lessonID, materialID)
+}
+
+// VerifyIntegrity re-hashes every stored file of a lesson and compares it with its sidecar
+func (f *FileService) VerifyIntegrity(lessonID string) ([]models.IntegrityResult, error) {
+	var paths []string
+
+	for _, lessonDir := range []string{f.VideoDir(lessonID), filepath.Join(f.cfg.MaterialsDir, lessonID)} {
+		err := filepath.WalkDir(lessonDir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() && IsDerivedDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && !IsMetadataFile(d.Name()) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", f.relativePath(lessonDir), err)
+		}
+	}
+
+	results := make([]models.IntegrityResult, 0, len(paths))
+	for _, path := range paths {
+		result := models.IntegrityResult{Path: f.relativePath(path)}
+
+		meta, err := ReadMetadata(path)
+		if err != nil {
+			result.Status = models.IntegrityMissingMetadata
+			results = append(results, result)
+			continue
+		}
+
+		actual, err := hashFile(path)
+		switch {
+		case err != nil:
+			result.Status = models.IntegrityError
+			result.Error = err.Error()
+		case actual != meta.Hash:
+			result.Status = models.IntegrityMismatch
+			result.ExpectedHash = meta.Hash
+			result.ActualHash = actual
+			log.Printf("⚠️ Integrity mismatch for %s: expected %s, got %s", path, meta.Hash, actual)
+		default:
+			result.Status = models.IntegrityOK
+			result.ExpectedHash = meta.Hash
+			result.ActualHash = actual
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// relativePath reports a stored file's path relative to the storage base directory
+func (f *FileService) relativePath(path string) string {
+	if rel, err := filepath.Rel(filepath.Dir(f.cfg.VideosDir), path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// PublicURL turns a public path (/videos/..., /materials/...) into an absolute URL
+func (f *FileService) PublicURL(path string) string {
+	publicBase := strings.TrimRight(f.cfg.PublicBaseURL, "/")
+	if publicBase == "" {
+		publicBase = "http://localhost:8081"
+	}
+	return publicBase + path
+}
+
+// ContentType returns the content type recorded at upload, falling back to the file extension
+func (f *FileService) ContentType(path, filename string) string {
+	if meta, err := ReadMetadata(path); err == nil && meta.ContentType != "" {
+		return meta.ContentType
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(filename)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// fileStats returns the SHA1 and duration of a stored file as recorded in its sidecar.
+// Files without a recorded hash are hashed once per size and mtime; the duration is never
+// probed here, so a file without a sidecar lists none.
+func (f *FileService) fileStats(path string, info os.FileInfo) fileStats {
+	var stats fileStats
+	if meta, err := ReadMetadata(path); err == nil {
+		stats.duration = meta.DurationInSeconds
+		if stats.duration == 0 {
+			stats.duration = meta.Media.DurationInSeconds()
+		}
+		if meta.Hash != "" {
+			stats.hash = meta.Hash
+			return stats
+		}
+	}
+
+	key := fileStatsKey{path: path, size: info.Size(), modTime: info.ModTime()}
+
+	f.statsMu.Lock()
+	cached, ok := f.stats[key]
+	f.statsMu.Unlock()
+	if ok {
+		stats.hash = cached.hash
+		return stats
+	}
+
+	if hash, err := hashFile(path); err == nil {
+		stats.hash = hash
+	} else {
+		log.Printf("Failed to hash %s: %v", path, err)
+	}
+
+	f.statsMu.Lock()
+	for existing := range f.stats {
+		if existing.path == path {
+			// Drop stats of replaced versions of this file
+			delete(f.stats, existing)
+		}
+	}
+	f.stats[key] = fileStats{hash: stats.hash}
+	f.statsMu.Unlock()
+
+	return stats
+}
+
+// subdirectories lists the names of the directories directly under dir
+func subdirectories(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// hashFile computes the same SHA1 the merge step records
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha1.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
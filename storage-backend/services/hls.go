@@ -0,0 +1,393 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"storage-backend/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HLS renditions of a video version live next to its MP4:
+//
+//	videos/<lesson_id>/<video_id>/v<N>/hls/master.m3u8
+//	videos/<lesson_id>/<video_id>/v<N>/hls/<size>p/index.m3u8, seg_00000.ts, ...
+//
+// With DASH enabled the renditions are encoded once as CMAF (fragmented MP4) segments
+// that both the HLS playlists and the DASH manifest point at (see dash.go):
+//
+//	videos/<lesson_id>/<video_id>/v<N>/cmaf/master.m3u8, manifest.mpd, init-<n>.m4s, chunk-<n>-00001.m4s, ...
+//
+// Keeping them per version means a replacement never mixes segments of two
+// uploads and a rollback brings back the matching ladder.
+
+// HLSDirName is the directory holding the HLS ladder of a video version
+const HLSDirName = "hls"
+
+// HLSMasterPlaylist is the master playlist inside HLSDirName
+const HLSMasterPlaylist = "master.m3u8"
+
+// hlsBitsPerPixel sizes the video bitrate of a rendition from its resolution and frame rate
+const hlsBitsPerPixel = 0.1
+
+// hlsRendition is one rung of the ladder
+type hlsRendition struct {
+	Name         string
+	Width        int
+	Height       int
+	FrameRate    float64
+	VideoBitrate int // kbps
+	AudioBitrate int // kbps
+}
+
+// h264Level is an H.264 level with the limits that decide whether a rendition fits it
+type h264Level struct {
+	name     string // As passed to ffmpeg's -level
+	idc      int    // level_idc, the last byte of an avc1 codec string
+	frameMBs int    // Macroblocks per frame
+	rateMBs  int    // Macroblocks per second
+}
+
+// h264Levels lists the levels a ladder uses, lowest first (H.264 table A-1)
+var h264Levels = []h264Level{
+	{"3.0", 30, 1620, 40500},
+	{"3.1", 31, 3600, 108000},
+	{"3.2", 32, 5120, 216000},
+	{"4.0", 40, 8192, 245760},
+	{"4.2", 42, 8704, 522240},
+	{"5.0", 50, 22080, 589824},
+	{"5.1", 51, 36864, 983040},
+	{"5.2", 52, 36864, 2073600},
+}
+
+// level returns the lowest H.264 level that fits the rendition's frame size and rate
+func (r hlsRendition) level() h264Level {
+	frameMBs := ((r.Width + 15) / 16) * ((r.Height + 15) / 16)
+	rateMBs := int(math.Ceil(float64(frameMBs) * r.FrameRate))
+	for _, level := range h264Levels {
+		if frameMBs <= level.frameMBs && rateMBs <= level.rateMBs {
+			return level
+		}
+	}
+	return h264Levels[len(h264Levels)-1]
+}
+
+// codecs returns the CODECS attribute of the rendition: H.264 Main, plus AAC-LC with audio
+func (r hlsRendition) codecs(hasAudio bool) string {
+	// 4d is the Main profile, 40 the constraint_set1 flag x264 sets for it
+	codecs := fmt.Sprintf("avc1.4d40%02x", r.level().idc)
+	if hasAudio {
+		codecs += ",mp4a.40.2"
+	}
+	return codecs
+}
+
+// videoStreamPublicPath returns the public path of a file in a streaming directory of a video version
+func videoStreamPublicPath(lessonID, videoID string, version int, dir, file string) string {
+	return path.Join(path.Dir(VideoPublicPath(lessonID, videoID, version)), dir, file)
+}
+
+// hlsStagingPrefix names the directory a ladder is encoded into before it replaces HLSDirName
+const hlsStagingPrefix = ".hls-"
+
+// IsDerivedDir reports whether a directory inside a video version holds files generated
+// from the video rather than uploaded ones; they carry no metadata sidecars
+func IsDerivedDir(name string) bool {
+	return name == HLSDirName || name == CMAFDirName || name == ImagesDirName ||
+		strings.HasPrefix(name, hlsStagingPrefix) || strings.HasPrefix(name, imagesStagingPrefix)
+}
+
+// packageStreams encodes the adaptive streaming ladder of a merged video next to it and records
+// the public paths of the HLS master playlist and, with DASH enabled, the DASH manifest in merged.
+// Renditions are reported in the session status as they are encoded.
+func (m *MergeService) packageStreams(uploadID string, session *models.UploadSession, merged *mergedFile) error {
+	if merged.Media == nil || merged.Media.Video == nil {
+		return fmt.Errorf("no probed video stream to size the ladder")
+	}
+
+	ladder := planHLSLadder(merged.Media, m.cfg.HLSRenditions)
+	progress := make([]models.RenditionProgress, len(ladder))
+	for i, rendition := range ladder {
+		progress[i] = models.RenditionProgress{Name: rendition.Name, Width: rendition.Width, Height: rendition.Height, Status: models.RenditionPending}
+	}
+	if m.uploadSvc != nil {
+		m.uploadSvc.SetRenditions(uploadID, progress)
+	}
+
+	// Encode into a staging directory and swap it in so players never see a partial ladder
+	versionDir := filepath.Dir(merged.Path)
+	staging := filepath.Join(versionDir, hlsStagingPrefix+uploadID)
+	os.RemoveAll(staging)
+	defer os.RemoveAll(staging)
+
+	// Startup rejects DASH_ENABLED together with HLS_ENCRYPTION, so CMAF ladders are never encrypted
+	cmaf := m.cfg.DASHEnabled
+
+	dirName := HLSDirName
+	start := time.Now()
+	if cmaf {
+		dirName = CMAFDirName
+		if err := m.encodeCMAFLadder(uploadID, merged, ladder, staging); err != nil {
+			return err
+		}
+	} else {
+		encrypted, err := m.encodeHLSLadder(uploadID, session, merged, ladder, staging)
+		if err != nil {
+			return err
+		}
+		merged.HLSEncrypted = encrypted
+	}
+
+	target := filepath.Join(versionDir, dirName)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, target); err != nil {
+		return fmt.Errorf("failed to move streaming ladder into place: %w", err)
+	}
+
+	merged.HLSPath = videoStreamPublicPath(session.LessonID, merged.FileID, merged.Version, dirName, HLSMasterPlaylist)
+	if cmaf {
+		merged.DASHPath = videoStreamPublicPath(session.LessonID, merged.FileID, merged.Version, dirName, DASHManifest)
+	}
+
+	log.Printf("📺 Upload %s: %s ladder with %d renditions ready in %v", uploadID, dirName, len(ladder), time.Since(start).Round(time.Second))
+	return nil
+}
+
+// encodeHLSLadder encodes every rendition as MPEG-TS HLS into dir in a single ffmpeg run, which
+// decodes the source once and keeps the renditions' keyframes aligned, then writes the master
+// playlist. It reports whether the segments were encrypted.
+func (m *MergeService) encodeHLSLadder(uploadID string, session *models.UploadSession, merged *mergedFile, ladder []hlsRendition, dir string) (bool, error) {
+	keyInfo := ""
+	if m.cfg.HLSEncryption {
+		var err error
+		if keyInfo, err = m.createHLSKey(session, merged); err != nil {
+			return false, err
+		}
+		defer os.Remove(keyInfo)
+	}
+	succeeded := false
+	defer func() {
+		if keyInfo != "" && !succeeded {
+			m.keys.Remove(session.LessonID, merged.FileID, merged.Version)
+		}
+	}()
+
+	for _, rendition := range ladder {
+		if err := os.MkdirAll(filepath.Join(dir, rendition.Name), 0755); err != nil {
+			return false, err
+		}
+	}
+
+	segment := strconv.Itoa(m.cfg.HLSSegmentSeconds)
+	args := []string{"-i", merged.Path, "-filter_complex", ladderScaleFilter(ladder)}
+
+	// Every variant gets its own copy of the audio track, as the hls muxer muxes audio into each variant
+	hasAudio := len(merged.Media.Audio) > 0
+	streamMap := make([]string, len(ladder))
+	for i, rendition := range ladder {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		streamMap[i] = fmt.Sprintf("v:%d,name:%s", i, rendition.Name)
+		if hasAudio {
+			args = append(args, "-map", "0:a:0")
+			streamMap[i] = fmt.Sprintf("v:%d,a:%d,name:%s", i, i, rendition.Name)
+		}
+	}
+
+	args = append(args,
+		"-c:v", "libx264",
+		"-preset", m.cfg.TranscodePreset,
+		"-profile:v", "main",
+		"-pix_fmt", "yuv420p",
+		// Keyframes on segment boundaries so every rendition switches at the same points
+		"-force_key_frames", "expr:gte(t,n_forced*"+segment+")",
+		"-sc_threshold", "0",
+	)
+	for i, rendition := range ladder {
+		args = append(args,
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+			// The level the master playlist's CODECS attribute announces
+			fmt.Sprintf("-level:v:%d", i), rendition.level().name,
+		)
+	}
+	if hasAudio {
+		args = append(args, "-c:a", "aac", "-ac", "2")
+		for i, rendition := range ladder {
+			args = append(args, fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", rendition.AudioBitrate))
+		}
+	}
+
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", segment,
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "%v", "seg_%05d.ts"),
+		"-var_stream_map", strings.Join(streamMap, " "),
+	)
+	if keyInfo != "" {
+		args = append(args, "-hls_key_info_file", keyInfo)
+	}
+	args = append(args, filepath.Join(dir, "%v", "index.m3u8"))
+
+	onProgress := m.ladderProgress(uploadID, ladder)
+	onProgress(0)
+	if err := m.encodeFFmpegProgress(merged.Media.DurationSeconds, onProgress, args...); err != nil {
+		m.reportLadder(uploadID, ladder, models.RenditionFailed, 0, err.Error())
+		return false, fmt.Errorf("HLS ladder: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, HLSMasterPlaylist), []byte(hlsMasterPlaylist(ladder, hasAudio)), 0644); err != nil {
+		m.reportLadder(uploadID, ladder, models.RenditionFailed, 0, "failed to write master playlist")
+		return false, fmt.Errorf("failed to write master playlist: %w", err)
+	}
+	m.reportLadder(uploadID, ladder, models.RenditionDone, 100, "")
+	succeeded = true
+	return keyInfo != "", nil
+}
+
+// createHLSKey stores a new key for the merged video version and writes the ffmpeg key info
+// file (key URI, then key path) into the tmp dir, returning the key info path. Packaging runs
+// after the upload's own tmp dir is cleaned up, so the file is not kept there.
+func (m *MergeService) createHLSKey(session *models.UploadSession, merged *mergedFile) (string, error) {
+	keyPath, err := m.keys.Create(session.LessonID, merged.FileID, merged.Version)
+	if err != nil {
+		return "", err
+	}
+
+	content := m.keys.KeyURL(session.LessonID, merged.FileID, merged.Version) + "\n" + keyPath + "\n"
+	file, err := os.CreateTemp(m.cfg.UploadTmpDir, "hls-*.keyinfo")
+	if err == nil {
+		_, err = file.WriteString(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(file.Name())
+		}
+	}
+	if err != nil {
+		m.keys.Remove(session.LessonID, merged.FileID, merged.Version)
+		return "", fmt.Errorf("failed to write key info: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// ladderScaleFilter splits the decoded video once and scales each copy to its rendition,
+// labelling the outputs [v0], [v1], ...
+func ladderScaleFilter(ladder []hlsRendition) string {
+	var filter strings.Builder
+	fmt.Fprintf(&filter, "[0:v]split=%d", len(ladder))
+	for i := range ladder {
+		fmt.Fprintf(&filter, "[s%d]", i)
+	}
+	for i, rendition := range ladder {
+		fmt.Fprintf(&filter, ";[s%d]scale=%d:%d[v%d]", i, rendition.Width, rendition.Height, i)
+	}
+	return filter.String()
+}
+
+// reportLadder sets every rendition of a ladder to the same state; renditions encoded
+// in one ffmpeg run progress together
+func (m *MergeService) reportLadder(uploadID string, ladder []hlsRendition, status string, percent float64, errorMsg string) {
+	if m.uploadSvc == nil {
+		return
+	}
+	for i := range ladder {
+		m.uploadSvc.UpdateRendition(uploadID, i, status, percent, errorMsg)
+	}
+}
+
+// ladderProgress returns an ffmpeg progress callback that reports the whole ladder as encoding
+func (m *MergeService) ladderProgress(uploadID string, ladder []hlsRendition) func(float64) {
+	lastReported := -1.0
+	return func(percent float64) {
+		// Status polling does not need more than whole percents
+		if percent-lastReported >= 1 {
+			lastReported = percent
+			m.reportLadder(uploadID, ladder, models.RenditionEncoding, math.Floor(percent), "")
+		}
+	}
+}
+
+// planHLSLadder picks the renditions for a video: every configured size up to the source size,
+// or a single rendition at the source size when it is smaller than all of them. Sizes apply to
+// the short side, so a portrait phone video gets a 1080p rung that is 1080 pixels wide.
+func planHLSLadder(media *models.MediaInfo, sizes []int) []hlsRendition {
+	// Players show the video rotated, and ffmpeg rotates it before scaling
+	sourceWidth, sourceHeight := media.Video.DisplaySize()
+	shortSide := sourceHeight
+	if sourceWidth < shortSide {
+		shortSide = sourceWidth
+	}
+
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+
+	var selected []int
+	for _, size := range sorted {
+		if size <= shortSide && (len(selected) == 0 || selected[len(selected)-1] != size) {
+			selected = append(selected, size)
+		}
+	}
+	if len(selected) == 0 {
+		selected = []int{shortSide}
+	}
+
+	frameRate := media.Video.FrameRate
+	if frameRate <= 0 || frameRate > 60 {
+		frameRate = 30
+	}
+
+	ladder := make([]hlsRendition, 0, len(selected))
+	for _, size := range selected {
+		scale := float64(size) / float64(shortSide)
+		width := evenDimension(float64(sourceWidth) * scale)
+		height := evenDimension(float64(sourceHeight) * scale)
+		audioBitrate := 128
+		if size <= 360 {
+			audioBitrate = 96
+		}
+		ladder = append(ladder, hlsRendition{
+			Name:         fmt.Sprintf("%dp", size),
+			Width:        width,
+			Height:       height,
+			FrameRate:    frameRate,
+			VideoBitrate: int(float64(width*height) * frameRate * hlsBitsPerPixel / 1000),
+			AudioBitrate: audioBitrate,
+		})
+	}
+	return ladder
+}
+
+// hlsMasterPlaylist lists the renditions, lowest first, with their peak bandwidth and codecs
+func hlsMasterPlaylist(ladder []hlsRendition, hasAudio bool) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rendition := range ladder {
+		bandwidth := rendition.VideoBitrate * 107 / 100
+		if hasAudio {
+			bandwidth += rendition.AudioBitrate
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\"\n%s/index.m3u8\n",
+			bandwidth*1000, rendition.Width, rendition.Height, rendition.codecs(hasAudio), rendition.Name)
+	}
+	return b.String()
+}
+
+// evenDimension rounds to the nearest even number of pixels (at least 2), as yuv420p requires
+func evenDimension(value float64) int {
+	even := int(math.Round(value/2)) * 2
+	if even < 2 {
+		return 2
+	}
+	return even
+}
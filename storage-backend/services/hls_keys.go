@@ -0,0 +1,102 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"storage-backend/config"
+	"storage-backend/utils"
+	"strings"
+)
+
+// HLSKeySize is the length of an AES-128 key
+const HLSKeySize = 16
+
+// HLSKeyStore keeps the AES-128 keys of encrypted HLS ladders under KeysDir, which nginx
+// never serves. Each video version has its own key:
+//
+//	keys/<lesson_id>/<video_id>/v<N>.key
+//
+// Players fetch keys from GET /keys/<lesson_id>/<video_id>/<N>, which checks lesson access.
+type HLSKeyStore struct {
+	cfg *config.Config
+}
+
+func NewHLSKeyStore(cfg *config.Config) *HLSKeyStore {
+	return &HLSKeyStore{cfg: cfg}
+}
+
+// KeyURL returns the URL written into playlists for the key of a video version
+func (k *HLSKeyStore) KeyURL(lessonID, videoID string, version int) string {
+	return fmt.Sprintf("%s/keys/%s/%s/%d", strings.TrimRight(k.cfg.HLSKeyBaseURL, "/"), lessonID, videoID, version)
+}
+
+// Create generates and stores a new key for a video version, returning its path
+func (k *HLSKeyStore) Create(lessonID, videoID string, version int) (string, error) {
+	path, err := k.keyPath(lessonID, videoID, version)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	key := make([]byte, HLSKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return "", fmt.Errorf("failed to store key: %w", err)
+	}
+	return path, nil
+}
+
+// Read returns the key of a video version, or ErrKeyNotFound
+func (k *HLSKeyStore) Read(lessonID, videoID string, version int) ([]byte, error) {
+	path, err := k.keyPath(lessonID, videoID, version)
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	if len(key) != HLSKeySize {
+		return nil, fmt.Errorf("key %s has %d bytes", path, len(key))
+	}
+	return key, nil
+}
+
+// Remove deletes the key of a single video version
+func (k *HLSKeyStore) Remove(lessonID, videoID string, version int) error {
+	path, err := k.keyPath(lessonID, videoID, version)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveVideo deletes the keys of every version of a video
+func (k *HLSKeyStore) RemoveVideo(lessonID, videoID string) error {
+	dir, err := utils.SafeJoin(k.cfg.KeysDir, lessonID, videoID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	// Drop the lesson directory once its last video is gone
+	os.Remove(filepath.Dir(dir))
+	return nil
+}
+
+func (k *HLSKeyStore) keyPath(lessonID, videoID string, version int) (string, error) {
+	return utils.SafeJoin(k.cfg.KeysDir, lessonID, videoID, VersionDirName(version)+".key")
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"storage-backend/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope used by upload grant tokens minted by the main backend
+const UploadGrantScope = "lesson_upload"
+
+// Allowed clock skew when checking exp/nbf
+const jwtLeeway = 30 * time.Second
+
+// TokenClaims are the JWT claims storage-backend understands.
+// Lesson-level claims come either from a user token carrying "lesson_ids"
+// or from an upload grant token carrying "scope" and "lesson_id".
+type TokenClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt int64       `json:"exp"`
+	NotBefore int64       `json:"nbf"`
+	IssuedAt  int64       `json:"iat"`
+	Scope     string      `json:"scope"`
+	LessonID  string      `json:"lesson_id"`
+	LessonIDs []string    `json:"lesson_ids"`
+}
+
+// HasLessonClaims reports whether the token itself says which lessons it grants
+func (c *TokenClaims) HasLessonClaims() bool {
+	if c.Scope == UploadGrantScope && c.LessonID != "" {
+		return true
+	}
+	return c.LessonIDs != nil
+}
+
+// AllowsLesson reports whether the lesson claims grant access to lessonID
+func (c *TokenClaims) AllowsLesson(lessonID string) bool {
+	if c.Scope == UploadGrantScope && c.LessonID == lessonID {
+		return true
+	}
+	for _, id := range c.LessonIDs {
+		if id == lessonID {
+			return true
+		}
+	}
+	return false
+}
+
+// jwtAudience accepts both the string and array forms of "aud"
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwksDocument struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// JWTVerifier validates HS256 tokens with JWT_SECRET and RS256 tokens with
+// public keys loaded from JWKS_FILE or JWKS_URL.
+type JWTVerifier struct {
+	cfg       *config.Config
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func NewJWTVerifier(cfg *config.Config) *JWTVerifier {
+	v := &JWTVerifier{
+		cfg:  cfg,
+		keys: make(map[string]*rsa.PublicKey),
+	}
+
+	if cfg.JWKSFile != "" || cfg.JWKSURL != "" {
+		if err := v.refreshKeys(); err != nil {
+			log.Printf("⚠️ Failed to load JWKS, RS256 tokens will be rejected until it loads: %v", err)
+		}
+	}
+
+	return v
+}
+
+// Verify checks the signature and standard claims of a token and returns its claims
+func (v *JWTVerifier) Verify(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding: %w", err)
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+
+	switch header.Alg {
+	case "HS256":
+		if !v.cfg.HS256Enabled() {
+			return nil, fmt.Errorf("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, []byte(v.cfg.JWTSecret))
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("invalid token signature")
+		}
+	case "RS256":
+		key, err := v.publicKey(header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("invalid token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	var claims TokenClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	if err := v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims *TokenClaims) error {
+	now := time.Now()
+
+	// Tokens without an expiry would stay valid forever once leaked
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf("token has no expiry")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("token not valid yet")
+	}
+	if v.cfg.JWTIssuer != "" && claims.Issuer != v.cfg.JWTIssuer {
+		return fmt.Errorf("unexpected token issuer %q", claims.Issuer)
+	}
+	if v.cfg.JWTAudience != "" {
+		found := false
+		for _, aud := range claims.Audience {
+			if aud == v.cfg.JWTAudience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("token audience mismatch")
+		}
+	}
+
+	return nil
+}
+
+// publicKey finds the RS256 key for kid, refetching JWKS_URL once if the key is unknown
+func (v *JWTVerifier) publicKey(kid string) (*rsa.PublicKey, error) {
+	if key := v.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	if v.cfg.JWKSURL == "" && v.cfg.JWKSFile == "" {
+		return nil, fmt.Errorf("RS256 tokens are not accepted")
+	}
+
+	// Unknown kid usually means the main backend rotated its keys.
+	// Limit refetches so garbage tokens cannot hammer the JWKS endpoint.
+	v.mu.RLock()
+	recentlyFetched := time.Since(v.fetchedAt) < time.Minute
+	v.mu.RUnlock()
+	if !recentlyFetched {
+		if err := v.refreshKeys(); err != nil {
+			log.Printf("⚠️ Failed to refresh JWKS: %v", err)
+		}
+	}
+
+	if key := v.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (v *JWTVerifier) lookupKey(kid string) *rsa.PublicKey {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	// Periodically refresh keys from a remote JWKS
+	if v.cfg.JWKSURL != "" && v.cfg.JWKSRefreshSeconds > 0 &&
+		time.Since(v.fetchedAt) > time.Duration(v.cfg.JWKSRefreshSeconds)*time.Second {
+		return nil
+	}
+
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key
+		}
+	}
+	return v.keys[kid]
+}
+
+func (v *JWTVerifier) refreshKeys() error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if v.cfg.JWKSURL != "" {
+		data, err = fetchJWKS(v.cfg.JWKSURL)
+	} else {
+		data, err = os.ReadFile(v.cfg.JWKSFile)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.fetchedAt = time.Now()
+
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	v.keys = keys
+	log.Printf("🔑 Loaded %d JWKS signing key(s)", len(keys))
+	return nil
+}
+
+func fetchJWKS(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var doc jwksDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no RSA signing keys")
+	}
+
+	return keys, nil
+}
+
+// peekTokenClaims decodes claims WITHOUT verifying the signature.
+// Only use the result for bookkeeping (cache indexing, expiry caps), never for access decisions.
+func peekTokenClaims(token string) *TokenClaims {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	var claims TokenClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil
+	}
+	return &claims
+}
+
+func decodeJWTSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"storage-backend/config"
+	"testing"
+	"time"
+)
+
+// signHS256 builds an HS256 token over claims with secret
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerifierHS256(t *testing.T) {
+	const secret = "0f6b1c8e4d2a9b7c3e5f1a8d6b4c2e9f"
+	valid := map[string]interface{}{"sub": "42", "exp": time.Now().Add(time.Hour).Unix()}
+
+	cases := []struct {
+		name   string
+		secret string // Configured JWT_SECRET
+		token  string
+		ok     bool
+	}{
+		{"valid", secret, signHS256(t, secret, valid), true},
+		{"wrong key", secret, signHS256(t, "another-secret", valid), false},
+		{"no secret configured", "", signHS256(t, "", valid), false},
+		{"forged with old default", "your-secret-key-change-in-production",
+			signHS256(t, "your-secret-key-change-in-production", valid), false},
+		{"forged with .env placeholder", "CHANGE_ME_SECRET", signHS256(t, "CHANGE_ME_SECRET", valid), false},
+		{"missing exp", secret, signHS256(t, secret, map[string]interface{}{"sub": "42"}), false},
+		{"expired", secret, signHS256(t, secret, map[string]interface{}{"sub": "42", "exp": time.Now().Add(-time.Hour).Unix()}), false},
+	}
+
+	for _, tc := range cases {
+		v := NewJWTVerifier(&config.Config{JWTSecret: tc.secret})
+		claims, err := v.Verify(tc.token)
+		if tc.ok && err != nil {
+			t.Errorf("%s: Verify failed: %v", tc.name, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s: Verify accepted the token with claims %+v", tc.name, claims)
+		}
+	}
+}
+
+func TestUploaderIdentity(t *testing.T) {
+	const secret = "0f6b1c8e4d2a9b7c3e5f1a8d6b4c2e9f"
+	claims := map[string]interface{}{"sub": "42", "exp": time.Now().Add(time.Hour).Unix()}
+
+	local := NewAuthService(&config.Config{JWTLocalVerify: true, JWTSecret: secret}, nil)
+	if got := local.UploaderIdentity(signHS256(t, secret, claims)); got != "42" {
+		t.Errorf("verified token: uploader = %q, want 42", got)
+	}
+	if got := local.UploaderIdentity(signHS256(t, "another-secret", claims)); got != "" {
+		t.Errorf("forged token: uploader = %q, want none", got)
+	}
+
+	// The main backend vouches for access, not for the subject an unverified token claims
+	remote := NewAuthService(&config.Config{}, nil)
+	if got := remote.UploaderIdentity(signHS256(t, "another-secret", claims)); got != "" {
+		t.Errorf("remote verification: uploader = %q, want none", got)
+	}
+}
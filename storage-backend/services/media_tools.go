@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"storage-backend/models"
+	"storage-backend/utils"
+	"time"
+)
+
+// mediaContext bounds one ffmpeg or ffprobe run to seconds; 0 means no limit
+func mediaContext(seconds int) (context.Context, context.CancelFunc) {
+	if seconds <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(seconds)*time.Second)
+}
+
+// probeMedia runs ffprobe on path within MEDIA_PROBE_TIMEOUT_SECONDS
+func (m *MergeService) probeMedia(path string) (*models.MediaInfo, error) {
+	ctx, cancel := mediaContext(m.cfg.MediaProbeTimeout)
+	defer cancel()
+	return utils.ProbeMedia(ctx, m.cfg.FFProbePath, path)
+}
+
+// decodeCheck decodes part of path within MEDIA_PROBE_TIMEOUT_SECONDS
+func (m *MergeService) decodeCheck(path string, start, length float64) error {
+	ctx, cancel := mediaContext(m.cfg.MediaProbeTimeout)
+	defer cancel()
+	return utils.DecodeCheck(ctx, m.cfg.FFmpegPath, path, start, length)
+}
+
+// grabFFmpeg runs a short ffmpeg job, such as extracting a single frame, within MEDIA_PROBE_TIMEOUT_SECONDS
+func (m *MergeService) grabFFmpeg(args ...string) error {
+	ctx, cancel := mediaContext(m.cfg.MediaProbeTimeout)
+	defer cancel()
+	return utils.RunFFmpeg(ctx, m.cfg.FFmpegPath, args...)
+}
+
+// encodeFFmpeg runs an ffmpeg job that processes the whole video within MEDIA_ENCODE_TIMEOUT_SECONDS
+func (m *MergeService) encodeFFmpeg(args ...string) error {
+	ctx, cancel := mediaContext(m.cfg.MediaEncodeTimeout)
+	defer cancel()
+	return utils.RunFFmpeg(ctx, m.cfg.FFmpegPath, args...)
+}
+
+// encodeFFmpegProgress is encodeFFmpeg reporting progress like utils.RunFFmpegProgress
+func (m *MergeService) encodeFFmpegProgress(duration float64, onProgress func(percent float64), args ...string) error {
+	ctx, cancel := mediaContext(m.cfg.MediaEncodeTimeout)
+	defer cancel()
+	return utils.RunFFmpegProgress(ctx, m.cfg.FFmpegPath, duration, onProgress, args...)
+}
@@ -1,10 +1,10 @@
 package services
 
 import (
-	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -21,21 +21,59 @@ import (
 	"github.com/google/uuid"
 )
 
+// mergedFile is a finalized upload at its permanent location
+type mergedFile struct {
+	Path            string
+	Hash            string
+	FileID          string // Video or material ID
+	Version         int    // Videos only
+	PreviousVersion int    // Videos only: version that was current before this one went live
+
+	Media        *models.MediaInfo   // Videos only: nil when ffprobe failed
+	Conversion   string              // Videos only: how the upload was converted to MP4, empty when stored as uploaded
+	HLSPath      string              // Videos only: public path of the HLS master playlist, empty without HLS
+	HLSEncrypted bool                // Videos only: HLS segments are AES-128 encrypted
+	DASHPath     string              // Videos only: public path of the DASH manifest, empty without DASH
+	Images       *models.VideoImages // Videos only: preview images, nil when none were extracted
+	Packaging    string              // Videos only: one of the models.Packaging constants, empty when nothing is generated
+
+	Replaced         bool   // Materials and captions: an existing file was replaced
+	PreviousFilename string // Materials only: name of the replaced file, which the replacement is stored under
+	CaptionConverted bool   // Captions only: uploaded as SRT and converted to WebVTT
+}
+
 type MergeJob struct {
 	UploadID string
 	Session  *models.UploadSession
 }
 
+// packageJob generates the preview images and streaming ladder of a video version that is already live
+type packageJob struct {
+	UploadID string
+	Session  *models.UploadSession
+	Merged   *mergedFile
+}
+
 type MergeService struct {
-	cfg       *config.Config
-	jobQueue  chan MergeJob
-	uploadSvc *UploadService
+	cfg          *config.Config
+	backend      *BackendClient
+	signer       *URLSigner
+	trash        *TrashService
+	keys         *HLSKeyStore
+	jobQueue     chan MergeJob
+	packageQueue chan packageJob
+	uploadSvc    *UploadService
 }
 
-func NewMergeService(cfg *config.Config) *MergeService {
+func NewMergeService(cfg *config.Config, backend *BackendClient, signer *URLSigner, trash *TrashService, keys *HLSKeyStore) *MergeService {
 	return &MergeService{
-		cfg:      cfg,
-		jobQueue: make(chan MergeJob, 100),
+		cfg:          cfg,
+		backend:      backend,
+		signer:       signer,
+		trash:        trash,
+		keys:         keys,
+		jobQueue:     make(chan MergeJob, 100),
+		packageQueue: make(chan packageJob, 100),
 	}
 }
 
@@ -66,6 +104,19 @@ func (m *MergeService) StartWorker() {
 		}(i)
 	}
 
+	for i := 0; i < m.cfg.PackageWorkers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			log.Printf("Package worker %d started", workerID)
+
+			for job := range m.packageQueue {
+				log.Printf("Package worker %d processing upload %s", workerID, job.UploadID)
+				m.processPackaging(job)
+			}
+		}(i)
+	}
+
 	wg.Wait()
 }
 
@@ -78,43 +129,114 @@ func (m *MergeService) processMerge(job MergeJob) {
 	}
 
 	// Merge parts
-	outputPath, hash, materialID, err := m.mergeParts(job.UploadID, session)
+	merged, err := m.mergeParts(job.UploadID, session)
 	if err != nil {
 		log.Printf("Failed to merge upload %s: %v", job.UploadID, err)
 		if m.uploadSvc != nil {
-			m.uploadSvc.UpdateStatus(job.UploadID, models.StatusFailed, err.Error())
+			m.uploadSvc.Fail(job.UploadID, failureCode(err), failureMessage(err))
+		}
+		// A rejected file will not become valid on retry
+		var validationErr *VideoValidationError
+		var captionErr *CaptionValidationError
+		if errors.As(err, &validationErr) || errors.As(err, &captionErr) {
+			m.cleanup(job.UploadID)
 		}
 		return
 	}
 
-	// Update session with output path
-	if m.uploadSvc != nil {
-		m.uploadSvc.SetOutputPath(job.UploadID, outputPath)
-		m.uploadSvc.UpdateStatus(job.UploadID, models.StatusReady, "")
+	// Record the upload next to the file; the webhook may fail but the sidecar stays
+	if err := m.writeMetadata(session, merged); err != nil {
+		log.Printf("Failed to write metadata for upload %s: %v", job.UploadID, err)
 	}
 
-	// Include hash in the log so the variable is used and for easier debugging
-	log.Printf("✓ Upload %s completed successfully! File saved to: %s (hash=%s)", job.UploadID, outputPath, hash)
-
-	duration := 0
+	// A video version only goes live once it is completely written
 	if session.Type == models.TypeVideo {
-		if d, err := utils.GetVideoDurationInSeconds(m.cfg.FFProbePath, outputPath); err != nil {
-			log.Printf("Failed to extract duration for upload %s: %v", job.UploadID, err)
-		} else {
-			duration = d
+		if err := m.publishVideoVersion(merged); err != nil {
+			log.Printf("Failed to publish video for upload %s: %v", job.UploadID, err)
+			// Nothing points at the version, so its directory would only take up space
+			os.RemoveAll(filepath.Dir(merged.Path))
+			if errors.Is(err, errVersionSuperseded) {
+				if m.uploadSvc != nil {
+					m.uploadSvc.Fail(job.UploadID, models.UploadErrorSuperseded, "a newer upload of this video went live while this one was processing")
+				}
+				m.cleanup(job.UploadID)
+				return
+			}
+			if m.uploadSvc != nil {
+				m.uploadSvc.Fail(job.UploadID, models.UploadErrorProcessingFailed, err.Error())
+			}
+			return
+		}
+		m.pruneVideoVersions(session, merged)
+
+		// The MP4 is live now; preview images and adaptive streaming are added on top of it
+		// after the backend has been told, so lessons do not wait for the encoder
+		if m.cfg.PreviewImages || m.cfg.HLSEnabled {
+			merged.Packaging = models.PackagingPending
+		}
+	}
+
+	// Update session with output path
+	if m.uploadSvc != nil {
+		m.uploadSvc.SetOutputPath(job.UploadID, merged.Path)
+		m.uploadSvc.SetContentHash(job.UploadID, merged.Hash)
+		status := models.StatusReady
+		if merged.Packaging == models.PackagingPending {
+			status = models.StatusPackaging
 		}
+		m.uploadSvc.UpdateStatus(job.UploadID, status, "")
 	}
 
-	if err := m.sendWebhook(session, outputPath, hash, duration, materialID); err != nil {
+	// Include hash in the log so the variable is used and for easier debugging
+	log.Printf("✓ Upload %s completed successfully! File saved to: %s (hash=%s)", job.UploadID, merged.Path, merged.Hash)
+
+	if err := m.sendWebhook(session, merged); err != nil {
 		log.Printf("Failed to send webhook for upload %s: %v", job.UploadID, err)
 		// Don't mark as failed if webhook fails - file is still ready
 	}
 
 	// Cleanup temp files
 	m.cleanup(job.UploadID)
+
+	// Packaging works on the published version only, so it does not need the tmp dir.
+	// A full queue holds this worker back rather than dropping the job.
+	if merged.Packaging == models.PackagingPending {
+		m.packageQueue <- packageJob{UploadID: job.UploadID, Session: session, Merged: merged}
+	}
+}
+
+// processPackaging generates the preview images and streaming ladder of a published video,
+// then sends the video-ready webhook again with their URLs
+func (m *MergeService) processPackaging(job packageJob) {
+	session, merged := job.Session, job.Merged
+
+	if m.cfg.PreviewImages {
+		m.addPreviewImages(job.UploadID, session, merged)
+	}
+	if m.cfg.HLSEnabled {
+		m.addStreams(job.UploadID, session, merged)
+	}
+	m.recordDerivedFiles(job.UploadID, merged)
+	merged.Packaging = models.PackagingComplete
+
+	if m.uploadSvc != nil {
+		m.uploadSvc.UpdateStatus(job.UploadID, models.StatusReady, "")
+	}
+
+	// Announcing a version that was replaced or rolled back meanwhile would point the backend back at it
+	current, err := pointedVideoVersion(filepath.Dir(filepath.Dir(merged.Path)))
+	if err != nil || current != merged.Version {
+		log.Printf("Upload %s: v%d of video %s/%s is no longer current, not sending its packaging webhook",
+			job.UploadID, merged.Version, session.LessonID, merged.FileID)
+		return
+	}
+
+	if err := m.sendWebhook(session, merged); err != nil {
+		log.Printf("Failed to send packaging webhook for upload %s: %v", job.UploadID, err)
+	}
 }
 
-func (m *MergeService) mergeParts(uploadID string, session *models.UploadSession) (string, string, string, error) {
+func (m *MergeService) mergeParts(uploadID string, session *models.UploadSession) (*mergedFile, error) {
 	uploadDir := filepath.Join(m.cfg.UploadTmpDir, uploadID)
 	partsDir := filepath.Join(uploadDir, "parts")
 
@@ -122,7 +244,7 @@ func (m *MergeService) mergeParts(uploadID string, session *models.UploadSession
 	tempOutput := filepath.Join(uploadDir, "input"+filepath.Ext(session.Filename))
 	outputFile, err := os.Create(tempOutput)
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to create output file: %w", err)
+		return nil, fmt.Errorf("failed to create output file: %w", err)
 	}
 	defer outputFile.Close()
 
@@ -138,7 +260,7 @@ func (m *MergeService) mergeParts(uploadID string, session *models.UploadSession
 
 		partFile, err := os.Open(partPath)
 		if err != nil {
-			return "", "", "", fmt.Errorf("failed to open part %d: %w", i, err)
+			return nil, fmt.Errorf("failed to open part %d: %w", i, err)
 		}
 
 		// Copy with LARGE buffer for maximum throughput
@@ -146,7 +268,7 @@ func (m *MergeService) mergeParts(uploadID string, session *models.UploadSession
 		partFile.Close()
 
 		if err != nil {
-			return "", "", "", fmt.Errorf("failed to copy part %d: %w", i, err)
+			return nil, fmt.Errorf("failed to copy part %d: %w", i, err)
 		}
 	}
 
@@ -160,47 +282,292 @@ func (m *MergeService) mergeParts(uploadID string, session *models.UploadSession
 	// Calculate hash for verification (optional, but keep for integrity check)
 	hashStr := hex.EncodeToString(hasher.Sum(nil))
 
+	// Captions are small text files stored in a single step
+	if session.Type == models.TypeCaption {
+		return m.storeCaption(uploadID, session, tempOutput)
+	}
+
+	// Convert and check the video while it is still in the tmp dir so a bad file never goes live
+	var prepared *preparedVideo
+	if session.Type == models.TypeVideo {
+		prepared, err = m.prepareVideo(uploadID, tempOutput)
+		if err != nil {
+			return nil, err
+		}
+		if prepared.Path != tempOutput {
+			tempOutput = prepared.Path
+			if hashStr, err = hashFile(tempOutput); err != nil {
+				return nil, fmt.Errorf("failed to hash converted video: %w", err)
+			}
+		}
+	}
+
 	// Determine final destination - SIMPLIFIED STRUCTURE
+	stored := false
 	var finalDir string
 	var finalPath string
-	var materialID string
+	var fileID string
+	var version int
 
 	if session.Type == models.TypeVideo {
-		// Simple structure: /videos/{lesson_id}/video.mp4
-		// No SHA1 subdirectory - easier to access via Nginx
-		finalDir = filepath.Join(m.cfg.VideosDir, session.LessonID)
-		finalPath = filepath.Join(finalDir, "video.mp4")
-		log.Printf("Video will be saved to: /videos/%s/video.mp4", session.LessonID)
+		// Each upload is a new version: /videos/{lesson_id}/{video_id}/v{N}/video.mp4
+		// A replacement never overwrites the version that is being watched
+		fileID = session.VideoID
+		if fileID == "" {
+			fileID = uuid.NewString()
+		}
+		videoDir, err := utils.SafeJoin(m.cfg.VideosDir, session.LessonID, fileID)
+		if err != nil {
+			return nil, err
+		}
+		version, finalDir, err = claimNextVideoVersion(videoDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create video version directory: %w", err)
+		}
+		// A version that never received its video must not block or confuse later claims
+		claimed := finalDir
+		defer func() {
+			if !stored {
+				os.RemoveAll(claimed)
+			}
+		}()
+		finalPath = filepath.Join(finalDir, VideoFilename)
+		log.Printf("Video will be saved to: %s", VideoPublicPath(session.LessonID, fileID, version))
 	} else {
-		// Materials: generate new material ID and store under that directory for stable URLs
-		materialID = uuid.NewString()
-		materialFolder := materialID
-		finalDir = filepath.Join(m.cfg.MaterialsDir, session.LessonID, materialFolder)
-		finalPath = filepath.Join(finalDir, session.Filename)
-		log.Printf("Material will be saved to: /materials/%s/%s/%s", session.LessonID, materialFolder, session.Filename)
+		// Materials: generate new material ID and store under that directory for stable URLs.
+		// A replacement reuses the existing material ID and the stored file name so saved links keep working.
+		fileID = session.MaterialID
+		if fileID == "" {
+			fileID = uuid.NewString()
+		}
+		materialFolder := fileID
+		finalDir, err = utils.SafeJoin(m.cfg.MaterialsDir, session.LessonID, materialFolder)
+		if err != nil {
+			return nil, err
+		}
+		storedName := session.Filename
+		if session.MaterialID != "" {
+			if current, err := storedMaterialFile(finalDir); err == nil && current != "" {
+				storedName = current
+			}
+		}
+		finalPath, err = utils.SafeJoin(finalDir, storedName)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Material will be saved to: /materials/%s/%s/%s", session.LessonID, materialFolder, storedName)
 	}
 
 	// Create final directory
 	if err := os.MkdirAll(finalDir, 0755); err != nil {
-		return "", "", "", fmt.Errorf("failed to create final directory: %w", err)
+		return nil, fmt.Errorf("failed to create final directory: %w", err)
+	}
+
+	merged := &mergedFile{Path: finalPath, Hash: hashStr, FileID: fileID, Version: version}
+	if prepared != nil {
+		merged.Media = prepared.Media
+		merged.Conversion = prepared.Conversion
+	}
+
+	// Replacing a material: the new file is written next to the current one before that moves to the trash
+	if session.Type == models.TypeMaterial && session.MaterialID != "" {
+		if err := m.replaceMaterialFile(uploadID, session, tempOutput, finalPath); err != nil {
+			return nil, err
+		}
+		merged.Replaced = true
+		merged.PreviousFilename = filepath.Base(finalPath)
+		return merged, nil
 	}
 
 	// Move file to final location
 	if err := os.Rename(tempOutput, finalPath); err != nil {
-		// If rename fails (cross-device), copy instead
-		if err := copyFile(tempOutput, finalPath); err != nil {
-			return "", "", "", fmt.Errorf("failed to move file: %w", err)
+		// If rename fails (cross-device), copy next to the target and rename
+		// so readers never see a partially written file
+		staging := filepath.Join(finalDir, ".upload-"+uploadID)
+		if err := copyFile(tempOutput, staging); err != nil {
+			os.Remove(staging)
+			return nil, fmt.Errorf("failed to move file: %w", err)
+		}
+		if err := os.Rename(staging, finalPath); err != nil {
+			os.Remove(staging)
+			return nil, fmt.Errorf("failed to move file: %w", err)
 		}
 		os.Remove(tempOutput)
 	}
 
-	return finalPath, hashStr, materialID, nil
+	stored = true
+	return merged, nil
+}
+
+// storedMaterialFile returns the name of the file stored for a material, empty when there is none
+func storedMaterialFile(materialDir string) (string, error) {
+	entries, err := os.ReadDir(materialDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read material directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || IsMetadataFile(entry.Name()) || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		return entry.Name(), nil
+	}
+	return "", nil
+}
+
+// replaceMaterialFile puts the merged upload at src in place of the material file at finalPath.
+// The upload is staged next to the target first, so the current file only goes to the trash once
+// its replacement is complete, and it is restored when the final rename fails.
+func (m *MergeService) replaceMaterialFile(uploadID string, session *models.UploadSession, src, finalPath string) error {
+	staging := filepath.Join(filepath.Dir(finalPath), ".upload-"+uploadID)
+	if err := os.Rename(src, staging); err != nil {
+		if err := copyFile(src, staging); err != nil {
+			os.Remove(staging)
+			return fmt.Errorf("failed to move file: %w", err)
+		}
+		os.Remove(src)
+	}
+
+	item, err := m.trash.Trash(models.TrashKindMaterial, session.LessonID, session.MaterialID, models.TrashReasonReplaced, "", finalPath)
+	if err != nil && !os.IsNotExist(err) {
+		os.Remove(staging)
+		return fmt.Errorf("failed to move replaced material to trash: %w", err)
+	}
+
+	if err := os.Rename(staging, finalPath); err != nil {
+		os.Remove(staging)
+		if item != nil {
+			if restoreErr := m.trash.Untrash(item); restoreErr != nil {
+				log.Printf("❗️Failed to restore replaced material %s from trash %s: %v", finalPath, item.TrashID, restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	log.Printf("Material %s/%s: replaced %q with upload %q", session.LessonID, session.MaterialID, filepath.Base(finalPath), session.Filename)
+	return nil
+}
+
+// addStreams packages the adaptive streaming ladder of a published video.
+// A failure is logged and the video stays available as MP4 only.
+func (m *MergeService) addStreams(uploadID string, session *models.UploadSession, merged *mergedFile) {
+	if err := m.packageStreams(uploadID, session, merged); err != nil {
+		log.Printf("Stream packaging failed for upload %s: %v", uploadID, err)
+	}
+}
+
+// recordDerivedFiles adds the streaming manifests and preview images generated after
+// publishing to the video's sidecar
+func (m *MergeService) recordDerivedFiles(uploadID string, merged *mergedFile) {
+	if merged.HLSPath == "" && merged.Images == nil {
+		return
+	}
+
+	meta, err := ReadMetadata(merged.Path)
+	if err != nil {
+		log.Printf("Failed to read metadata for upload %s: %v", uploadID, err)
+		return
+	}
+	meta.HLSPath = merged.HLSPath
+	meta.HLSEncrypted = merged.HLSEncrypted
+	meta.DASHPath = merged.DASHPath
+	meta.Images = merged.Images
+	if err := WriteMetadata(merged.Path, meta); err != nil {
+		log.Printf("Failed to record derived files for upload %s: %v", uploadID, err)
+	}
+}
+
+// publishVideoVersion atomically makes the merged version the current one of its video,
+// unless a newer version went live while it was processing
+func (m *MergeService) publishVideoVersion(merged *mergedFile) error {
+	pointer, err := advanceVideoVersion(filepath.Dir(filepath.Dir(merged.Path)), merged.Version)
+	if err != nil {
+		return err
+	}
+	merged.PreviousVersion = pointer.PreviousVersion
+	return nil
+}
+
+// pruneVideoVersions moves versions beyond VIDEO_VERSIONS_KEEP to the trash once a new one is live
+func (m *MergeService) pruneVideoVersions(session *models.UploadSession, merged *mergedFile) {
+	videoDir := filepath.Dir(filepath.Dir(merged.Path))
+	expired, err := expiredVideoVersions(videoDir, m.cfg.VideoVersionsKeep)
+	if err != nil {
+		log.Printf("Failed to list old versions of video %s/%s: %v", session.LessonID, merged.FileID, err)
+		return
+	}
+
+	for _, version := range expired {
+		path := filepath.Join(videoDir, VersionDirName(version))
+		if version == 0 {
+			path = versionedVideoPath(videoDir, 0) // Unversioned video.mp4 in the video directory
+		}
+		item, err := m.trash.Trash(models.TrashKindVideo, session.LessonID, merged.FileID, models.TrashReasonReplaced, "", path)
+		if err != nil {
+			log.Printf("Failed to move v%d of video %s/%s to trash: %v", version, session.LessonID, merged.FileID, err)
+			continue
+		}
+		// A trashed version keeps its key so it still plays once restored
+		if item.TrashID == "" && m.keys != nil {
+			m.keys.Remove(session.LessonID, merged.FileID, version)
+		}
+	}
+	if len(expired) > 0 {
+		log.Printf("Video %s/%s: moved %d old version(s) to trash, keeping %d", session.LessonID, merged.FileID, len(expired), m.cfg.VideoVersionsKeep)
+	}
+}
+
+// writeMetadata records the upload in a sidecar next to the merged file
+func (m *MergeService) writeMetadata(session *models.UploadSession, merged *mergedFile) error {
+	info, err := os.Stat(merged.Path)
+	if err != nil {
+		return err
+	}
+
+	var videoID, materialID string
+	if session.Type == models.TypeMaterial {
+		materialID = merged.FileID
+	} else {
+		videoID = merged.FileID
+	}
+
+	contentType, sourceContentType := session.ContentType, ""
+	if session.Type == models.TypeVideo && contentType != VideoContentType {
+		contentType, sourceContentType = VideoContentType, session.ContentType
+	}
+	if session.Type == models.TypeCaption {
+		contentType = CaptionContentType
+		if merged.CaptionConverted {
+			sourceContentType = session.ContentType
+		}
+	}
+
+	return WriteMetadata(merged.Path, &models.FileMetadata{
+		UploadID:          session.UploadID,
+		LessonID:          session.LessonID,
+		Type:              session.Type,
+		VideoID:           videoID,
+		Version:           merged.Version,
+		MaterialID:        materialID,
+		Filename:          session.Filename,
+		ContentType:       contentType,
+		SourceContentType: sourceContentType,
+		Conversion:        merged.Conversion,
+		SizeBytes:         info.Size(),
+		HashAlgorithm:     "sha1",
+		Hash:              merged.Hash,
+		DurationInSeconds: merged.Media.DurationInSeconds(),
+		Media:             merged.Media,
+		Language:          session.Language,
+		UploaderID:        session.UploaderID,
+		UploadStartedAt:   session.CreatedAt,
+		UploadedAt:        time.Now(),
+	})
 }
 
-func (m *MergeService) sendWebhook(session *models.UploadSession, _ string, _ string, duration int, materialID string) error {
+func (m *MergeService) sendWebhook(session *models.UploadSession, merged *mergedFile) error {
 	var (
-		webhookURL string
-		payload    interface{}
+		webhookPath string
+		payload     interface{}
 	)
 
 	publicBase := strings.TrimRight(m.cfg.PublicBaseURL, "/")
@@ -210,32 +577,82 @@ func (m *MergeService) sendWebhook(session *models.UploadSession, _ string, _ st
 
 	switch session.Type {
 	case models.TypeVideo:
-		webhookURL = m.cfg.MainBackendURL + "/internal/storage/video-ready"
-		videoURL := fmt.Sprintf("%s/videos/%s/video.mp4", publicBase, session.LessonID)
+		webhookPath = "/internal/storage/video-ready"
+		videoPath := VideoPublicPath(session.LessonID, merged.FileID, merged.Version)
+		videoURL := publicBase + videoPath
 		videoPayload := models.VideoReadyWebhook{
-			LessonID: session.LessonID,
-			VideoURL: videoURL,
+			LessonID:        session.LessonID,
+			VideoID:         merged.FileID,
+			Version:         merged.Version,
+			PreviousVersion: merged.PreviousVersion,
+			VideoURL:        videoURL,
+			Packaging:       merged.Packaging,
+		}
+		if merged.HLSPath != "" {
+			videoPayload.HLSURL = publicBase + merged.HLSPath
+			videoPayload.HLSEncrypted = merged.HLSEncrypted
 		}
-		if duration > 0 {
-			videoPayload.DurationInSeconds = duration
+		if merged.DASHPath != "" {
+			videoPayload.DASHURL = publicBase + merged.DASHPath
+		}
+		if images := merged.Images; images != nil {
+			videoPayload.PosterURL = publicBase + images.Poster
+			for _, thumbnail := range images.Thumbnails {
+				videoPayload.ThumbnailURLs = append(videoPayload.ThumbnailURLs, publicBase+thumbnail)
+			}
+			videoPayload.SpriteURL = publicBase + images.Sprite
+			videoPayload.SpriteVTTURL = publicBase + images.SpriteVTT
+		}
+		videoPayload.SetMedia(merged.Media)
+		videoPayload.TranscriptURL = transcriptURL(m.captionTracks(session.LessonID, merged.FileID, publicBase), m.cfg.CaptionDefaultLanguage)
+		if signed := m.signURL(videoPath); signed != nil {
+			videoPayload.SignedURL = signed.URL
+			videoPayload.SignedURLExpiresAt = &signed.ExpiresAt
 		}
 		payload = videoPayload
 		log.Printf("Video URL for webhook: %s", videoURL)
 
 	case models.TypeMaterial:
-		webhookURL = m.cfg.MainBackendURL + "/internal/storage/file-ready"
+		webhookPath = "/internal/storage/file-ready"
+		materialID := merged.FileID
 		if materialID == "" {
 			materialID = session.UploadID
 		}
-		fileURL := fmt.Sprintf("%s/materials/%s/%s/%s", publicBase, session.LessonID, materialID, session.Filename)
-		payload = models.FileReadyWebhook{
+		storedName := filepath.Base(merged.Path)
+		filePath := fmt.Sprintf("/materials/%s/%s/%s", session.LessonID, materialID, storedName)
+		fileURL := publicBase + filePath
+		filePayload := models.FileReadyWebhook{
 			LessonID:    session.LessonID,
 			MaterialID:  materialID,
 			FileURL:     fileURL,
-			Filename:    session.Filename,
+			Filename:    storedName,
 			SizeBytes:   session.ExpectedSize,
 			ContentType: session.ContentType,
 		}
+		if merged.Replaced {
+			filePayload.Replaced = true
+			filePayload.PreviousFilename = merged.PreviousFilename
+			filePayload.UploadedFilename = session.Filename
+		}
+		if signed := m.signURL(filePath); signed != nil {
+			filePayload.SignedURL = signed.URL
+			filePayload.SignedURLExpiresAt = &signed.ExpiresAt
+		}
+		payload = filePayload
+
+	case models.TypeCaption:
+		webhookPath = "/internal/storage/captions-ready"
+		captionsPayload := models.CaptionsReadyWebhook{
+			LessonID:   session.LessonID,
+			VideoID:    merged.FileID,
+			Language:   session.Language,
+			CaptionURL: publicBase + CaptionPublicPath(session.LessonID, merged.FileID, session.Language),
+			Replaced:   merged.Replaced,
+			Converted:  merged.CaptionConverted,
+			Captions:   m.captionTracks(session.LessonID, merged.FileID, publicBase),
+		}
+		captionsPayload.TranscriptURL = transcriptURL(captionsPayload.Captions, m.cfg.CaptionDefaultLanguage)
+		payload = captionsPayload
 
 	default:
 		return fmt.Errorf("unsupported upload type for webhook: %s", session.Type)
@@ -246,17 +663,26 @@ func (m *MergeService) sendWebhook(session *models.UploadSession, _ string, _ st
 		return fmt.Errorf("failed to marshal webhook payload: %w", err)
 	}
 
-	log.Printf("Sending webhook to %s with payload: %s", webhookURL, string(jsonData))
+	log.Printf("Sending webhook to %s with payload: %s", webhookPath, string(jsonData))
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	// Ready webhooks carry the full state of the file, so redelivery is harmless
+	resp, err := m.backend.Do(BackendRequest{
+		Method:     http.MethodPost,
+		Path:       webhookPath,
+		Body:       jsonData,
+		Header:     header,
+		Timeout:    time.Duration(m.cfg.BackendWebhookTimeout) * time.Second,
+		Idempotent: true,
+	})
 	if err != nil {
-		log.Printf("❌ Failed to send webhook to %s: %v", webhookURL, err)
+		log.Printf("❌ Failed to send webhook to %s: %v", webhookPath, err)
 		return fmt.Errorf("failed to send webhook: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	body := resp.Body
 
 	if resp.StatusCode >= 400 {
 		log.Printf("❌ Webhook returned error %d: %s", resp.StatusCode, string(body))
@@ -267,6 +693,20 @@ func (m *MergeService) sendWebhook(session *models.UploadSession, _ string, _ st
 	return nil
 }
 
+// signURL returns a signed URL for a webhook payload, or nil when signing is disabled
+func (m *MergeService) signURL(path string) *SignedURL {
+	if m.signer == nil || !m.signer.Enabled() {
+		return nil
+	}
+
+	signed, err := m.signer.Sign(SignURLOptions{Path: path})
+	if err != nil {
+		log.Printf("Failed to sign URL %s: %v", path, err)
+		return nil
+	}
+	return signed
+}
+
 func (m *MergeService) cleanup(uploadID string) {
 	uploadDir := filepath.Join(m.cfg.UploadTmpDir, uploadID)
 
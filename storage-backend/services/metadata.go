@@ -0,0 +1,68 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"storage-backend/models"
+	"strings"
+)
+
+// MetadataSuffix is appended to a stored file's name to get its sidecar
+const MetadataSuffix = ".meta.json"
+
+// MetadataPath returns the sidecar path for a stored file
+func MetadataPath(filePath string) string {
+	return filePath + MetadataSuffix
+}
+
+// IsMetadataFile reports whether name is a sidecar rather than a stored file
+func IsMetadataFile(name string) bool {
+	return strings.HasSuffix(name, MetadataSuffix)
+}
+
+// WriteMetadata atomically writes the sidecar for filePath
+func WriteMetadata(filePath string, meta *models.FileMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	target := MetadataPath(filePath)
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".meta-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create metadata file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to move metadata into place: %w", err)
+	}
+	return nil
+}
+
+// ReadMetadata loads the sidecar for filePath
+func ReadMetadata(filePath string) (*models.FileMetadata, error) {
+	data, err := os.ReadFile(MetadataPath(filePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var meta models.FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("invalid metadata for %s: %w", filePath, err)
+	}
+	return &meta, nil
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"storage-backend/config"
+	"storage-backend/models"
+	"time"
+)
+
+// ReconcileService compares what is stored on disk with what the main backend
+// still considers live, and reports or quarantines the differences.
+type ReconcileService struct {
+	cfg     *config.Config
+	fileSvc *FileService
+	backend *BackendClient
+}
+
+func NewReconcileService(cfg *config.Config, fileSvc *FileService, backend *BackendClient) *ReconcileService {
+	return &ReconcileService{cfg: cfg, fileSvc: fileSvc, backend: backend}
+}
+
+// Run pages through every lesson stored locally. With dryRun, orphans are only reported;
+// otherwise they are moved under QuarantineDir/<run timestamp>/ for manual review.
+func (r *ReconcileService) Run(dryRun bool) (*models.ReconcileReport, error) {
+	report := &models.ReconcileReport{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Orphans:   []models.ReconcileItem{},
+		Missing:   []models.ReconcileItem{},
+	}
+
+	lessonIDs, err := r.fileSvc.ListLessonIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	quarantineRoot := filepath.Join(r.cfg.QuarantineDir, report.StartedAt.UTC().Format("20060102T150405Z"))
+
+	batchSize := r.cfg.ReconcileBatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	for start := 0; start < len(lessonIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(lessonIDs) {
+			end = len(lessonIDs)
+		}
+		batch := lessonIDs[start:end]
+
+		live, err := r.fetchLiveLessons(batch)
+		if err != nil {
+			// Never quarantine on a failed answer; report and move on to the next page
+			report.Errors = append(report.Errors, fmt.Sprintf("lessons %s..%s: %v", batch[0], batch[len(batch)-1], err))
+			continue
+		}
+
+		for _, lessonID := range batch {
+			report.LessonsScanned++
+
+			lesson, known := live[lessonID]
+			if !known {
+				continue
+			}
+			r.reconcileLesson(lessonID, lesson, dryRun, quarantineRoot, report)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	log.Printf("🧾 Reconciliation finished (dry_run=%v): %d lessons, %d orphan(s), %d missing, %d error(s)",
+		dryRun, report.LessonsScanned, len(report.Orphans), len(report.Missing), len(report.Errors))
+
+	return report, nil
+}
+
+func (r *ReconcileService) reconcileLesson(lessonID string, lesson models.ReconcileLesson, dryRun bool, quarantineRoot string, report *models.ReconcileReport) {
+	r.reconcileVideos(lessonID, lesson, dryRun, quarantineRoot, report)
+
+	liveMaterials := make(map[string]bool)
+	if lesson.Exists {
+		for _, id := range lesson.MaterialIDs {
+			liveMaterials[id] = true
+		}
+	}
+
+	localMaterials, err := r.fileSvc.MaterialIDs(lessonID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("lesson %s: failed to list materials: %v", lessonID, err))
+		return
+	}
+
+	stored := make(map[string]bool)
+	for _, materialID := range localMaterials {
+		stored[materialID] = true
+		if liveMaterials[materialID] {
+			continue
+		}
+		item := models.ReconcileItem{
+			LessonID:   lessonID,
+			MaterialID: materialID,
+			Kind:       models.ReconcileKindMaterial,
+			Path:       r.fileSvc.MaterialDir(lessonID, materialID),
+		}
+		report.Orphans = append(report.Orphans, r.handleOrphan(item, dryRun, quarantineRoot))
+	}
+
+	for materialID := range liveMaterials {
+		if !stored[materialID] {
+			report.Missing = append(report.Missing, models.ReconcileItem{
+				LessonID:   lessonID,
+				MaterialID: materialID,
+				Kind:       models.ReconcileKindMaterial,
+			})
+		}
+	}
+
+	if !lesson.Exists && !dryRun {
+		// Drop the now-empty lesson directories
+		os.Remove(r.fileSvc.VideoDir(lessonID))
+		os.Remove(filepath.Join(r.cfg.MaterialsDir, lessonID))
+	}
+}
+
+// reconcileVideos compares stored videos by video ID. Main backends that do not
+// send video_ids get the lesson's videos reconciled as a whole by has_video.
+func (r *ReconcileService) reconcileVideos(lessonID string, lesson models.ReconcileLesson, dryRun bool, quarantineRoot string, report *models.ReconcileReport) {
+	if lesson.VideoIDs == nil {
+		hasVideo := r.fileSvc.HasVideo(lessonID)
+		if hasVideo && (!lesson.Exists || !lesson.HasVideo) {
+			item := models.ReconcileItem{LessonID: lessonID, Kind: models.ReconcileKindVideo, Path: r.fileSvc.VideoDir(lessonID)}
+			report.Orphans = append(report.Orphans, r.handleOrphan(item, dryRun, quarantineRoot))
+		}
+		if !hasVideo && lesson.Exists && lesson.HasVideo {
+			report.Missing = append(report.Missing, models.ReconcileItem{LessonID: lessonID, Kind: models.ReconcileKindVideo})
+		}
+		return
+	}
+
+	// A legacy video.mp4 has no ID, so it is only orphaned once the lesson has no video at all
+	if r.fileSvc.HasLegacyVideo(lessonID) && (!lesson.Exists || !lesson.HasVideo) {
+		item := models.ReconcileItem{LessonID: lessonID, Kind: models.ReconcileKindVideo, Path: r.fileSvc.VideoPath(lessonID, "", 0)}
+		report.Orphans = append(report.Orphans, r.handleOrphan(item, dryRun, quarantineRoot))
+	}
+
+	liveVideos := make(map[string]bool)
+	if lesson.Exists {
+		for _, id := range lesson.VideoIDs {
+			liveVideos[id] = true
+		}
+	}
+
+	localVideos, err := r.fileSvc.VideoIDs(lessonID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("lesson %s: failed to list videos: %v", lessonID, err))
+		return
+	}
+
+	stored := make(map[string]bool)
+	for _, videoID := range localVideos {
+		stored[videoID] = true
+		if liveVideos[videoID] {
+			continue
+		}
+		item := models.ReconcileItem{
+			LessonID: lessonID,
+			VideoID:  videoID,
+			Kind:     models.ReconcileKindVideo,
+			Path:     filepath.Join(r.fileSvc.VideoDir(lessonID), videoID),
+		}
+		report.Orphans = append(report.Orphans, r.handleOrphan(item, dryRun, quarantineRoot))
+	}
+
+	for videoID := range liveVideos {
+		if !stored[videoID] {
+			report.Missing = append(report.Missing, models.ReconcileItem{
+				LessonID: lessonID,
+				VideoID:  videoID,
+				Kind:     models.ReconcileKindVideo,
+			})
+		}
+	}
+}
+
+func (r *ReconcileService) handleOrphan(item models.ReconcileItem, dryRun bool, quarantineRoot string) models.ReconcileItem {
+	// A fresh upload is on disk before the main backend records it from the webhook
+	minAge := time.Duration(r.cfg.ReconcileMinAgeMinutes) * time.Minute
+	if changed, err := lastModified(item.Path); err != nil || time.Since(changed) < minAge {
+		item.Action = "skipped"
+		log.Printf("🧾 Orphan %s changed within %v, skipped: %s", item.Kind, minAge, item.Path)
+		return item
+	}
+
+	if dryRun {
+		item.Action = "reported"
+		log.Printf("🧾 Orphan %s: %s", item.Kind, item.Path)
+		return item
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(r.cfg.VideosDir), item.Path)
+	if err != nil {
+		item.Action = "failed"
+		return item
+	}
+	target := filepath.Join(quarantineRoot, rel)
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		log.Printf("Failed to create quarantine directory for %s: %v", item.Path, err)
+		item.Action = "failed"
+		return item
+	}
+	if err := os.Rename(item.Path, target); err != nil {
+		log.Printf("Failed to quarantine %s: %v", item.Path, err)
+		item.Action = "failed"
+		return item
+	}
+	moveIfExists(MetadataPath(item.Path), MetadataPath(target))
+
+	log.Printf("🧾 Quarantined orphan %s: %s -> %s", item.Kind, item.Path, target)
+	item.Action = "quarantined"
+	item.Path = target
+	return item
+}
+
+// lastModified returns the newest modification time of path and everything below it
+func lastModified(path string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
+
+// fetchLiveLessons asks the main backend which of lessonIDs are still live
+func (r *ReconcileService) fetchLiveLessons(lessonIDs []string) (map[string]models.ReconcileLesson, error) {
+	jsonData, err := json.Marshal(models.ReconcileRequest{LessonIDs: lessonIDs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reconcile request: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Internal-API-Key", r.cfg.InternalAPIKey)
+
+	// Read-only lookup, safe to retry
+	resp, err := r.backend.Do(BackendRequest{
+		Method:     http.MethodPost,
+		Path:       "/internal/storage/reconcile",
+		Body:       jsonData,
+		Header:     header,
+		Timeout:    time.Duration(r.cfg.BackendWebhookTimeout) * time.Second,
+		Idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("main backend returned status %d: %s", resp.StatusCode, string(resp.Body))
+	}
+
+	var parsed models.ReconcileResponse
+	if err := json.Unmarshal(resp.Body, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid reconcile response: %w", err)
+	}
+
+	live := make(map[string]models.ReconcileLesson, len(parsed.Lessons))
+	for _, lesson := range parsed.Lessons {
+		live[lesson.LessonID] = lesson
+	}
+	return live, nil
+}
+
+// StartJob runs reconciliation every interval until the process exits
+func (r *ReconcileService) StartJob(interval time.Duration, dryRun bool) {
+	log.Printf("🧾 Reconciliation job scheduled every %v (dry_run=%v)", interval, dryRun)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := r.Run(dryRun); err != nil {
+			log.Printf("Reconciliation failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"storage-backend/config"
+	"storage-backend/models"
+	"storage-backend/utils"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const trashItemFile = "item.json"
+
+// TrashService implements soft delete: deleted trees are moved under TrashDir
+// and can be restored until the retention period expires and the purge job removes them.
+type TrashService struct {
+	cfg  *config.Config
+	keys *HLSKeyStore
+	mu   sync.Mutex // Serializes moves in and out of the trash
+}
+
+func NewTrashService(cfg *config.Config, keys *HLSKeyStore) *TrashService {
+	return &TrashService{cfg: cfg, keys: keys}
+}
+
+// Enabled reports whether deletes go to the trash instead of being permanent
+func (t *TrashService) Enabled() bool {
+	return t.cfg.TrashRetentionHours > 0
+}
+
+// Trash moves path into the trash. It returns os.ErrNotExist when path does not exist.
+// fileID is the material ID for materials and the video ID otherwise, and reason one of the TrashReason constants.
+// batchID groups the items of one delete request; an empty one starts a batch of its own.
+// A single file moves together with its sidecar.
+// With the trash disabled the tree is removed permanently and the returned item has no TrashID.
+func (t *TrashService) Trash(kind, lessonID, fileID, reason, batchID, path string) (*models.TrashItem, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	isFile := !info.IsDir()
+
+	size, count, err := treeSize(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure %s: %w", path, err)
+	}
+
+	rel, err := filepath.Rel(t.baseDir(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	item := &models.TrashItem{
+		Kind:         kind,
+		LessonID:     lessonID,
+		Reason:       reason,
+		OriginalPath: rel,
+		SizeBytes:    size,
+		FileCount:    count,
+		DeletedAt:    now,
+	}
+	if kind == models.TrashKindMaterial {
+		item.MaterialID = fileID
+	} else {
+		item.VideoID = fileID
+	}
+
+	if !t.Enabled() {
+		if err := os.RemoveAll(path); err != nil {
+			return nil, err
+		}
+		if isFile {
+			os.Remove(MetadataPath(path))
+		}
+		t.dropVideoKeys(item)
+		log.Printf("Deleted %s (%d files, %d bytes)", rel, count, size)
+		return item, nil
+	}
+
+	item.TrashID = uuid.NewString()
+	item.BatchID = batchID
+	if item.BatchID == "" {
+		item.BatchID = item.TrashID
+	}
+	item.PurgeAfter = now.Add(time.Duration(t.cfg.TrashRetentionHours) * time.Hour)
+
+	itemDir := filepath.Join(t.cfg.TrashDir, item.TrashID)
+	if err := os.MkdirAll(itemDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create trash entry: %w", err)
+	}
+	if err := writeTrashItem(itemDir, item); err != nil {
+		os.RemoveAll(itemDir)
+		return nil, err
+	}
+	data := filepath.Join(itemDir, "data")
+	if err := os.Rename(path, data); err != nil {
+		os.RemoveAll(itemDir)
+		return nil, fmt.Errorf("failed to move %s to trash: %w", path, err)
+	}
+	if isFile {
+		moveIfExists(MetadataPath(path), MetadataPath(data))
+	}
+
+	log.Printf("🗑️ Moved %s to trash %s (%d files, %d bytes, purge after %s)",
+		rel, item.TrashID, count, size, item.PurgeAfter.Format(time.RFC3339))
+	return item, nil
+}
+
+// List returns trashed items, newest first. An empty lessonID lists everything.
+func (t *TrashService) List(lessonID string) ([]models.TrashItem, error) {
+	entries, err := os.ReadDir(t.cfg.TrashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.TrashItem{}, nil
+		}
+		return nil, err
+	}
+
+	items := []models.TrashItem{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		item, err := readTrashItem(filepath.Join(t.cfg.TrashDir, entry.Name()))
+		if err != nil {
+			log.Printf("Skipping unreadable trash entry %s: %v", entry.Name(), err)
+			continue
+		}
+		if lessonID != "" && item.LessonID != lessonID {
+			continue
+		}
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// Restore moves the items of one delete batch of a lesson back into place. An empty batchID
+// picks the lesson's most recent batch; with kind and fileID set only that video or material's
+// items are considered. Items an upload replaced are never restored in bulk, since that would
+// bring back superseded files; RestoreItem restores them one at a time.
+func (t *TrashService) Restore(lessonID, kind, fileID, batchID string) ([]models.TrashItem, error) {
+	items, err := t.List(lessonID)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	restored := []models.TrashItem{}
+	for _, item := range items {
+		if item.Reason != models.TrashReasonDeleted {
+			continue
+		}
+		if fileID != "" && (item.Kind != kind || (item.VideoID != fileID && item.MaterialID != fileID)) {
+			continue
+		}
+		// Items are listed newest first, so the first match names the most recent batch
+		if batchID == "" {
+			batchID = trashBatch(item)
+		}
+		if trashBatch(item) != batchID {
+			continue
+		}
+
+		if err := t.restoreItem(&item); err != nil {
+			return restored, err
+		}
+		restored = append(restored, item)
+	}
+
+	if len(restored) == 0 {
+		return nil, ErrNothingToRestore
+	}
+	return restored, nil
+}
+
+// RestoreItem moves a single trashed item back into place, whatever the reason it was trashed for
+func (t *TrashService) RestoreItem(trashID string) (*models.TrashItem, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	item, err := readTrashItem(filepath.Join(t.cfg.TrashDir, trashID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNothingToRestore
+		}
+		return nil, err
+	}
+	if err := t.restoreItem(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// trashBatch returns the batch of an item; items trashed before batches were recorded form their own
+func trashBatch(item models.TrashItem) string {
+	if item.BatchID != "" {
+		return item.BatchID
+	}
+	return item.TrashID
+}
+
+// Untrash moves a single trashed item back to where it was deleted from
+func (t *TrashService) Untrash(item *models.TrashItem) error {
+	if item.TrashID == "" {
+		return ErrNothingToRestore
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.restoreItem(item)
+}
+
+// restoreItem moves a trashed item back into place; t.mu must be held
+func (t *TrashService) restoreItem(item *models.TrashItem) error {
+	target, err := utils.SafeJoin(t.baseDir(), item.OriginalPath)
+	if err != nil {
+		return fmt.Errorf("trash %s: %w", item.TrashID, err)
+	}
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("%w: %s", ErrRestoreConflict, item.OriginalPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to recreate parent of %s: %w", item.OriginalPath, err)
+	}
+
+	itemDir := filepath.Join(t.cfg.TrashDir, item.TrashID)
+	data := filepath.Join(itemDir, "data")
+	if err := os.Rename(data, target); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", item.OriginalPath, err)
+	}
+	moveIfExists(MetadataPath(data), MetadataPath(target))
+	os.RemoveAll(itemDir)
+
+	log.Printf("♻️ Restored %s from trash %s", item.OriginalPath, item.TrashID)
+	return nil
+}
+
+// Purge permanently deletes items whose retention period has passed
+func (t *TrashService) Purge() (int, error) {
+	items, err := t.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	purged := 0
+	for _, item := range items {
+		if now.Before(item.PurgeAfter) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(t.cfg.TrashDir, item.TrashID)); err != nil {
+			log.Printf("Failed to purge trash %s: %v", item.TrashID, err)
+			continue
+		}
+		t.dropVideoKeys(&item)
+		log.Printf("🔥 Purged %s (trash %s, deleted %s)", item.OriginalPath, item.TrashID, item.DeletedAt.Format(time.RFC3339))
+		purged++
+	}
+	return purged, nil
+}
+
+// StartPurgeJob purges expired trash every interval until the process exits
+func (t *TrashService) StartPurgeJob(interval time.Duration) {
+	log.Printf("🗑️ Trash purge job scheduled every %v (retention %dh)", interval, t.cfg.TrashRetentionHours)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := t.Purge(); err != nil {
+			log.Printf("Trash purge failed: %v", err)
+		}
+	}
+}
+
+// dropVideoKeys removes the HLS keys of a permanently deleted video. Keys stay while the
+// video is in the trash so a restored video still plays, and are kept if it was restored or re-uploaded.
+func (t *TrashService) dropVideoKeys(item *models.TrashItem) {
+	if t.keys == nil || item.Kind != models.TrashKindVideo || item.VideoID == "" {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(t.cfg.VideosDir, item.LessonID, item.VideoID)); err == nil {
+		return
+	}
+	if err := t.keys.RemoveVideo(item.LessonID, item.VideoID); err != nil {
+		log.Printf("Failed to remove HLS keys of video %s/%s: %v", item.LessonID, item.VideoID, err)
+	}
+}
+
+func (t *TrashService) baseDir() string {
+	return filepath.Dir(t.cfg.VideosDir)
+}
+
+func writeTrashItem(itemDir string, item *models.TrashItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trash item: %w", err)
+	}
+	return os.WriteFile(filepath.Join(itemDir, trashItemFile), data, 0644)
+}
+
+func readTrashItem(itemDir string) (*models.TrashItem, error) {
+	data, err := os.ReadFile(filepath.Join(itemDir, trashItemFile))
+	if err != nil {
+		return nil, err
+	}
+	var item models.TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// moveIfExists renames src to dst, ignoring a missing src
+func moveIfExists(src, dst string) {
+	if err := os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to move %s to %s: %v", src, dst, err)
+	}
+}
+
+// treeSize returns the total size and number of regular files under path
+func treeSize(path string) (int64, int, error) {
+	var size int64
+	var count int
+	err := filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			count++
+		}
+		return nil
+	})
+	return size, count, err
+}
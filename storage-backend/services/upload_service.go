@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"storage-backend/config"
 	"storage-backend/models"
+	"storage-backend/utils"
+	"strings"
 	"sync"
 	"time"
 
@@ -92,7 +94,41 @@ func (s *UploadService) DecrementActive() {
 
 func (s *UploadService) CreateSession(req *models.InitUploadRequest, uploadType models.UploadType) (*models.UploadSession, error) {
 	if !s.CanAcceptUpload() {
-		return nil, fmt.Errorf("too many concurrent uploads, please retry later")
+		return nil, ErrTooManyUploads
+	}
+
+	if (uploadType == models.TypeVideo || uploadType == models.TypeCaption) && req.VideoID != "" {
+		videoDir, err := utils.SafeJoin(s.cfg.VideosDir, req.LessonID, req.VideoID)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(videoDir); err != nil || !info.IsDir() {
+			return nil, ErrVideoNotFound
+		}
+	}
+
+	if uploadType == models.TypeMaterial && req.MaterialID != "" {
+		materialDir, err := utils.SafeJoin(s.cfg.MaterialsDir, req.LessonID, req.MaterialID)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(materialDir); err != nil || !info.IsDir() {
+			return nil, ErrMaterialNotFound
+		}
+
+		// The replaced file goes to the trash; without one a failed or mistaken replacement is unrecoverable
+		if s.cfg.TrashRetentionHours <= 0 {
+			return nil, ErrReplaceWithoutTrash
+		}
+
+		// The replacement is stored under the current name, so it has to be the same kind of file
+		current, err := storedMaterialFile(materialDir)
+		if err != nil {
+			return nil, err
+		}
+		if current != "" && !strings.EqualFold(filepath.Ext(current), filepath.Ext(req.Filename)) {
+			return nil, fmt.Errorf("%w: expected a %q file like %s", ErrReplacementTypeMismatch, filepath.Ext(current), current)
+		}
 	}
 
 	uploadID := uuid.New().String()
@@ -106,6 +142,7 @@ func (s *UploadService) CreateSession(req *models.InitUploadRequest, uploadType
 		Type:          uploadType,
 		Filename:      req.Filename,
 		ContentType:   req.ContentType,
+		UploaderID:    req.UploaderID,
 		ExpectedSize:  req.Size,
 		ReceivedBytes: 0,
 		Status:        models.StatusInitiated,
@@ -115,6 +152,16 @@ func (s *UploadService) CreateSession(req *models.InitUploadRequest, uploadType
 		CreatedAt:     time.Now(),
 	}
 
+	switch uploadType {
+	case models.TypeVideo:
+		session.VideoID = req.VideoID
+	case models.TypeCaption:
+		session.VideoID = req.VideoID
+		session.Language = req.Language
+	default:
+		session.MaterialID = req.MaterialID
+	}
+
 	// Create upload directory
 	uploadDir := s.getUploadDir(uploadID)
 	if err := os.MkdirAll(filepath.Join(uploadDir, "parts"), 0755); err != nil {
@@ -139,7 +186,7 @@ func (s *UploadService) GetSession(uploadID string) (*models.UploadSession, erro
 
 	session, exists := s.sessions[uploadID]
 	if !exists {
-		return nil, fmt.Errorf("upload session not found")
+		return nil, ErrSessionNotFound
 	}
 
 	// Return a COPY to avoid race conditions when caller reads fields
@@ -157,7 +204,16 @@ func (s *UploadService) GetSession(uploadID string) (*models.UploadSession, erro
 		CreatedAt:     session.CreatedAt,
 		CompletedAt:   session.CompletedAt,
 		Error:         session.Error,
+		ErrorCode:     session.ErrorCode,
 		OutputPath:    session.OutputPath,
+		ContentHash:   session.ContentHash,
+		UploaderID:    session.UploaderID,
+		VideoID:       session.VideoID,
+		MaterialID:    session.MaterialID,
+		Language:      session.Language,
+	}
+	if session.Renditions != nil {
+		sessionCopy.Renditions = append([]models.RenditionProgress(nil), session.Renditions...)
 	}
 
 	return sessionCopy, nil
@@ -170,7 +226,7 @@ func (s *UploadService) ValidateToken(uploadID, token string) error {
 	}
 
 	if session.UploadToken != token {
-		return fmt.Errorf("invalid upload token")
+		return ErrInvalidUploadToken
 	}
 
 	return nil
@@ -184,7 +240,7 @@ func (s *UploadService) GetUploadedParts(uploadID string) ([]int, error) {
 	s.mu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("upload session not found")
+		return nil, ErrSessionNotFound
 	}
 
 	// Check which part files actually exist on disk
@@ -247,7 +303,7 @@ updateSession:
 
 	session, exists := s.sessions[uploadID]
 	if !exists {
-		return fmt.Errorf("upload session not found")
+		return ErrSessionNotFound
 	}
 
 	// Check if already received (idempotent)
@@ -272,27 +328,48 @@ updateSession:
 	return nil
 }
 
-func (s *UploadService) MarkComplete(uploadID string) error {
+// MarkComplete moves a fully received upload to uploaded and reports whether its merge must be
+// enqueued. Only a receiving upload or a retryable failed merge starts one; an upload that is
+// already uploaded, merging, packaging or ready is left alone and its current status returned,
+// so a repeated complete never runs a second merge over the same parts.
+func (s *UploadService) MarkComplete(uploadID string) (bool, models.UploadStatus, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	session, exists := s.sessions[uploadID]
 	if !exists {
-		return fmt.Errorf("upload session not found")
+		return false, "", ErrSessionNotFound
+	}
+
+	switch session.Status {
+	case models.StatusInitiated, models.StatusReceiving:
+	case models.StatusFailed:
+		// Only a merge that failed for reasons other than the file can run again; rejected files
+		// have their parts removed
+		if session.ErrorCode != models.UploadErrorProcessingFailed {
+			return false, session.Status, ErrUploadRejected
+		}
+	default:
+		return false, session.Status, nil
 	}
 
 	// Verify all parts received
 	for i := 1; i <= session.TotalParts; i++ {
 		if !session.PartsReceived[i] {
-			return fmt.Errorf("missing part %d", i)
+			return false, session.Status, fmt.Errorf("%w: missing part %d", ErrIncompleteUpload, i)
 		}
 	}
 
-	session.Status = models.StatusUploaded
+	// The upload stopped counting as active the first time it was completed
+	if session.Status == models.StatusInitiated || session.Status == models.StatusReceiving {
+		s.DecrementActive()
+	}
 
-	s.DecrementActive()
+	session.Status = models.StatusUploaded
+	session.ErrorCode = ""
+	session.Error = ""
 
-	return nil
+	return true, session.Status, nil
 }
 
 func (s *UploadService) UpdateStatus(uploadID string, status models.UploadStatus, errorMsg string) {
@@ -311,6 +388,20 @@ func (s *UploadService) UpdateStatus(uploadID string, status models.UploadStatus
 	}
 }
 
+// Fail marks a session as failed with a machine-readable code and a message for the uploader
+func (s *UploadService) Fail(uploadID, code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[uploadID]; exists {
+		now := time.Now()
+		session.Status = models.StatusFailed
+		session.ErrorCode = code
+		session.Error = message
+		session.CompletedAt = &now
+	}
+}
+
 func (s *UploadService) SetOutputPath(uploadID, path string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -320,6 +411,40 @@ func (s *UploadService) SetOutputPath(uploadID, path string) {
 	}
 }
 
+func (s *UploadService) SetContentHash(uploadID, hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[uploadID]; exists {
+		session.ContentHash = hash
+	}
+}
+
+// SetRenditions replaces the HLS rendition list reported in the session status
+func (s *UploadService) SetRenditions(uploadID string, renditions []models.RenditionProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[uploadID]; exists {
+		session.Renditions = renditions
+	}
+}
+
+// UpdateRendition records the state of the rendition at index
+func (s *UploadService) UpdateRendition(uploadID string, index int, status string, progress float64, errorMsg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[uploadID]
+	if !exists || index < 0 || index >= len(session.Renditions) {
+		return
+	}
+	rendition := &session.Renditions[index]
+	rendition.Status = status
+	rendition.Progress = progress
+	rendition.Error = errorMsg
+}
+
 func (s *UploadService) getUploadDir(uploadID string) string {
 	return filepath.Join(s.cfg.UploadTmpDir, uploadID)
 }
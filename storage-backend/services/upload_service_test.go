@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"storage-backend/config"
+	"storage-backend/models"
+	"testing"
+)
+
+func TestMarkComplete(t *testing.T) {
+	cases := []struct {
+		name      string
+		status    models.UploadStatus
+		errorCode string
+		missing   bool // Part 2 never arrived
+		queued    bool
+		want      models.UploadStatus // Status after the call
+		err       error
+	}{
+		{"receiving", models.StatusReceiving, "", false, true, models.StatusUploaded, nil},
+		{"initiated", models.StatusInitiated, "", false, true, models.StatusUploaded, nil},
+		{"missing part", models.StatusReceiving, "", true, false, models.StatusReceiving, ErrIncompleteUpload},
+		{"retryable failure", models.StatusFailed, models.UploadErrorProcessingFailed, false, true, models.StatusUploaded, nil},
+		{"rejected file", models.StatusFailed, models.UploadErrorCorruptVideo, false, false, models.StatusFailed, ErrUploadRejected},
+		{"already uploaded", models.StatusUploaded, "", false, false, models.StatusUploaded, nil},
+		{"merging", models.StatusMerging, "", false, false, models.StatusMerging, nil},
+		{"packaging", models.StatusPackaging, "", false, false, models.StatusPackaging, nil},
+		{"ready", models.StatusReady, "", false, false, models.StatusReady, nil},
+		{"ready with parts removed", models.StatusReady, "", true, false, models.StatusReady, nil},
+	}
+
+	for _, tc := range cases {
+		svc := &UploadService{cfg: &config.Config{}, sessions: make(map[string]*models.UploadSession)}
+		svc.sessions["upload"] = &models.UploadSession{
+			UploadID:      "upload",
+			Status:        tc.status,
+			ErrorCode:     tc.errorCode,
+			TotalParts:    2,
+			PartsReceived: map[int]bool{1: true, 2: !tc.missing},
+		}
+
+		queued, status, err := svc.MarkComplete("upload")
+		if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.err)
+		}
+		if queued != tc.queued {
+			t.Errorf("%s: queued = %v, want %v", tc.name, queued, tc.queued)
+		}
+		if got := svc.sessions["upload"].Status; got != tc.want || status != tc.want {
+			t.Errorf("%s: status = %s (returned %s), want %s", tc.name, got, status, tc.want)
+		}
+	}
+
+	// Only the first of two completes queues a merge
+	svc := &UploadService{cfg: &config.Config{}, sessions: make(map[string]*models.UploadSession)}
+	svc.sessions["upload"] = &models.UploadSession{UploadID: "upload", Status: models.StatusReceiving, TotalParts: 1, PartsReceived: map[int]bool{1: true}}
+	if queued, _, err := svc.MarkComplete("upload"); !queued || err != nil {
+		t.Fatalf("first complete: queued = %v, error = %v", queued, err)
+	}
+	if queued, status, err := svc.MarkComplete("upload"); queued || err != nil || status != models.StatusUploaded {
+		t.Errorf("second complete: queued = %v, status = %s, error = %v; want not queued and uploaded", queued, status, err)
+	}
+}
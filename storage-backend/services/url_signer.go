@@ -0,0 +1,154 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"storage-backend/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signing modes for download URLs
+const (
+	// SignModeHMAC signs with HMAC-SHA256 and is verified by storage-backend (/authz, /files)
+	SignModeHMAC = "hmac"
+	// SignModeNginx produces URLs verifiable by nginx secure_link:
+	//   secure_link $arg_md5,$arg_expires;
+	//   secure_link_md5 "$secure_link_expires$uri$remote_addr$arg_uid <secret>";
+	// ($remote_addr only when SIGNED_URL_BIND_IP=true)
+	SignModeNginx = "nginx"
+)
+
+// SignURLOptions describes the URL to sign
+type SignURLOptions struct {
+	Path     string        // Public path, e.g. /videos/<lesson_id>/video.mp4
+	TTL      time.Duration // Zero uses SIGNED_URL_TTL
+	UserID   string        // Optional: binds the URL to a user (carried in "uid")
+	ClientIP string        // Optional: binds the URL to the client address
+}
+
+// SignedURL is an absolute, expiring download URL
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// URLSigner mints and verifies expiring download URLs for /videos/ and /materials/
+type URLSigner struct {
+	cfg *config.Config
+}
+
+func NewURLSigner(cfg *config.Config) *URLSigner {
+	return &URLSigner{cfg: cfg}
+}
+
+// Enabled reports whether signed URLs are configured
+func (s *URLSigner) Enabled() bool {
+	return s.cfg.SignedURLsEnabled && s.cfg.SignedURLSecret != ""
+}
+
+// Sign returns an absolute signed URL for opts.Path
+func (s *URLSigner) Sign(opts SignURLOptions) (*SignedURL, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("signed URLs are not enabled")
+	}
+	if !strings.HasPrefix(opts.Path, "/videos/") && !strings.HasPrefix(opts.Path, "/materials/") {
+		return nil, fmt.Errorf("only /videos/ and /materials/ paths can be signed")
+	}
+
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = time.Duration(s.cfg.SignedURLTTL) * time.Second
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	if opts.UserID != "" {
+		query.Set("uid", opts.UserID)
+	}
+
+	switch s.cfg.SignedURLMode {
+	case SignModeNginx:
+		// nginx's secure_link expression is fixed, so IP binding is all-or-nothing
+		if s.cfg.SignedURLBindIP && opts.ClientIP == "" {
+			return nil, fmt.Errorf("client_ip is required when SIGNED_URL_BIND_IP is enabled")
+		}
+		query.Set("md5", s.nginxSignature(opts.Path, expires, opts.UserID, opts.ClientIP))
+	default:
+		if opts.ClientIP != "" {
+			query.Set("ip", "1")
+		}
+		query.Set("sig", s.hmacSignature(opts.Path, expires, opts.UserID, opts.ClientIP))
+	}
+
+	publicBase := strings.TrimRight(s.cfg.PublicBaseURL, "/")
+	escapedPath := (&url.URL{Path: opts.Path}).EscapedPath()
+
+	return &SignedURL{
+		URL:       fmt.Sprintf("%s%s?%s", publicBase, escapedPath, query.Encode()),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Verify checks a signed request. path is the decoded request path (nginx's $uri),
+// query the request's query parameters and clientIP the caller's address.
+// On success it returns the bound user ID, if any.
+func (s *URLSigner) Verify(path string, query url.Values, clientIP string) (string, error) {
+	if !s.Enabled() {
+		return "", ErrSignedURLInvalid
+	}
+
+	expires := query.Get("expires")
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", ErrSignedURLInvalid
+	}
+
+	userID := query.Get("uid")
+
+	var expected, actual string
+	switch s.cfg.SignedURLMode {
+	case SignModeNginx:
+		actual = query.Get("md5")
+		expected = s.nginxSignature(path, expires, userID, clientIP)
+	default:
+		actual = query.Get("sig")
+		boundIP := ""
+		if query.Get("ip") == "1" {
+			boundIP = clientIP
+		}
+		expected = s.hmacSignature(path, expires, userID, boundIP)
+	}
+
+	if actual == "" || !hmac.Equal([]byte(actual), []byte(expected)) {
+		return "", ErrSignedURLInvalid
+	}
+	if time.Now().Unix() > expiresUnix {
+		return "", ErrSignedURLExpired
+	}
+
+	return userID, nil
+}
+
+func (s *URLSigner) hmacSignature(path, expires, userID, clientIP string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.SignedURLSecret))
+	mac.Write([]byte(strings.Join([]string{path, expires, userID, clientIP}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// nginxSignature mirrors secure_link_md5 "$secure_link_expires$uri$remote_addr$arg_uid <secret>"
+func (s *URLSigner) nginxSignature(path, expires, userID, clientIP string) string {
+	remoteAddr := ""
+	if s.cfg.SignedURLBindIP {
+		remoteAddr = clientIP
+	}
+	sum := md5.Sum([]byte(expires + path + remoteAddr + userID + " " + s.cfg.SignedURLSecret))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
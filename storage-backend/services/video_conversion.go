@@ -0,0 +1,170 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"storage-backend/models"
+	"storage-backend/utils"
+	"strconv"
+	"time"
+)
+
+// Conversion modes recorded in the metadata sidecar
+const (
+	ConversionRemux     = "remux"     // Streams copied unchanged into an MP4 container
+	ConversionTranscode = "transcode" // At least one stream re-encoded to H.264/AAC
+)
+
+// Files written next to the merged upload in its tmp dir
+const (
+	faststartVideoName = "faststart.mp4"
+	convertedVideoName = "converted.mp4"
+)
+
+// preparedVideo is a merged video ready to be moved into place
+type preparedVideo struct {
+	Path       string // The merged upload, or the converted MP4 next to it
+	Media      *models.MediaInfo
+	Conversion string
+}
+
+// prepareVideo converts a merged upload to a browser-playable MP4 when needed and validates the result.
+// Uploads that already are H.264/AAC MP4 are left untouched, compatible streams in another container are
+// remuxed and everything else is transcoded. With VALIDATE_VIDEOS off a file ffprobe cannot read is kept as is.
+func (m *MergeService) prepareVideo(uploadID, path string) (*preparedVideo, error) {
+	path = m.faststartVideo(uploadID, path)
+	prepared := &preparedVideo{Path: path}
+
+	media, err := m.probeMedia(path)
+	if err != nil {
+		if !m.cfg.ValidateVideos {
+			log.Printf("Failed to probe video for upload %s: %v", uploadID, err)
+			return prepared, nil
+		}
+		return nil, mediaError(models.UploadErrorUnsupportedFormat, "the uploaded file is not a video format we can read", err)
+	}
+
+	if mode := conversionMode(path, media); mode != "" {
+		if m.uploadSvc != nil {
+			m.uploadSvc.UpdateStatus(uploadID, models.StatusConverting, "")
+		}
+		converted := filepath.Join(filepath.Dir(path), convertedVideoName)
+		start := time.Now()
+		if err := m.convertVideo(path, converted, media, mode); err != nil {
+			return nil, mediaError(models.UploadErrorConversionFailed, "the uploaded video could not be converted to MP4", err)
+		}
+		log.Printf("🎬 Upload %s converted to MP4 (%s %s) in %v", uploadID, mode, media.Container, time.Since(start).Round(time.Millisecond))
+
+		prepared.Path = converted
+		prepared.Conversion = mode
+		media = nil // Probe the converted file instead
+	}
+
+	if m.cfg.ValidateVideos {
+		if media, err = m.validateVideo(prepared.Path, media); err != nil {
+			return nil, err
+		}
+		log.Printf("✓ Upload %s is a playable video (%s %dx%d, %.1fs)", uploadID, media.Video.Codec, media.Video.Width, media.Video.Height, media.DurationSeconds)
+	} else if media == nil {
+		if media, err = m.probeMedia(prepared.Path); err != nil {
+			log.Printf("Failed to probe converted video for upload %s: %v", uploadID, err)
+		}
+	}
+
+	prepared.Media = media
+	return prepared, nil
+}
+
+// faststartVideo moves the moov box of an MP4 upload in front of its media data so playback
+// starts without fetching the end of the file, and returns the path of the file to keep.
+// A failure only costs instant start, so it is logged and the upload kept as is.
+func (m *MergeService) faststartVideo(uploadID, path string) string {
+	if !m.cfg.Faststart {
+		return path
+	}
+	if _, err := utils.MP4Brand(path); err != nil {
+		return path // Not an MP4; conversion writes a faststart file anyway
+	}
+
+	needed, err := utils.NeedsFaststart(path)
+	if err != nil {
+		log.Printf("Skipping faststart for upload %s: %v", uploadID, err)
+		return path
+	}
+	if !needed {
+		return path
+	}
+
+	relocated := filepath.Join(filepath.Dir(path), faststartVideoName)
+	start := time.Now()
+	if err := utils.Faststart(path, relocated); err != nil {
+		log.Printf("Skipping faststart for upload %s: %v", uploadID, err)
+		os.Remove(relocated)
+		return path
+	}
+	log.Printf("⚡ Upload %s: moved moov in front of media data in %v", uploadID, time.Since(start).Round(time.Millisecond))
+	return relocated
+}
+
+// conversionMode decides how a probed upload becomes a playable MP4: "" when it already is one
+func conversionMode(path string, media *models.MediaInfo) string {
+	// Nothing to convert; validation reports the missing video track
+	if media.Video == nil {
+		return ""
+	}
+	if !playableVideo(media.Video) || !playableAudio(media.Audio) {
+		return ConversionTranscode
+	}
+
+	brand, err := utils.MP4Brand(path)
+	if err != nil || brand == "qt  " {
+		return ConversionRemux
+	}
+	return ""
+}
+
+// convertVideo writes an H.264/AAC MP4 of src to dst. Streams that are already
+// playable are copied even when transcoding so only what has to be re-encoded is.
+func (m *MergeService) convertVideo(src, dst string, media *models.MediaInfo, mode string) error {
+	args := []string{"-i", src, "-map", "0:v:0", "-map", "0:a:0?", "-sn", "-dn"}
+
+	if mode == ConversionTranscode && !playableVideo(media.Video) {
+		args = append(args,
+			"-c:v", "libx264",
+			"-preset", m.cfg.TranscodePreset,
+			"-crf", strconv.Itoa(m.cfg.TranscodeCRF),
+			"-pix_fmt", "yuv420p",
+			// yuv420p needs even dimensions
+			"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2")
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+
+	if mode == ConversionTranscode && !playableAudio(media.Audio) {
+		args = append(args, "-c:a", "aac", "-b:a", "128k", "-ac", "2")
+	} else {
+		args = append(args, "-c:a", "copy")
+	}
+
+	args = append(args, "-movflags", "+faststart", "-f", "mp4", dst)
+
+	if err := m.encodeFFmpeg(args...); err != nil {
+		return fmt.Errorf("%s of %s failed: %w", mode, filepath.Base(src), err)
+	}
+	return nil
+}
+
+func playableVideo(video *models.VideoStreamInfo) bool {
+	return video != nil && playableVideoCodecs[video.Codec] && playablePixelFormats[video.PixelFormat]
+}
+
+func playableAudio(audio []models.AudioStreamInfo) bool {
+	for _, stream := range audio {
+		if !playableAudioCodecs[stream.Codec] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"storage-backend/models"
+	"storage-backend/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Preview images of a video version live next to its MP4:
+//
+//	videos/<lesson_id>/<video_id>/v<N>/images/poster.jpg
+//	videos/<lesson_id>/<video_id>/v<N>/images/thumb_01.jpg, thumb_02.jpg, ...
+//	videos/<lesson_id>/<video_id>/v<N>/images/sprite.jpg, sprite.vtt
+//
+// sprite.vtt is a WebVTT track whose cues point at tiles of sprite.jpg with
+// media fragments (sprite.jpg#xywh=x,y,w,h), the format players use for
+// thumbnail previews while scrubbing.
+
+// ImagesDirName is the directory holding the preview images of a video version
+const ImagesDirName = "images"
+
+const (
+	posterImage     = "poster.jpg"
+	spriteImage     = "sprite.jpg"
+	spriteVTT       = "sprite.vtt"
+	spriteMaxTiles  = 400 // Longer videos get a wider interval instead of a taller sheet
+	thumbnailFormat = "thumb_%02d.jpg"
+)
+
+// imagesStagingPrefix names the directory images are extracted into before it replaces ImagesDirName
+const imagesStagingPrefix = ".images-"
+
+// spriteSheet is the tile layout of a sprite sheet
+type spriteSheet struct {
+	Interval   int // Seconds between tiles
+	Tiles      int
+	Columns    int
+	Rows       int
+	TileWidth  int
+	TileHeight int
+}
+
+// addPreviewImages extracts the poster, thumbnails and sprite sheet of a published video.
+// A failure is logged and the video stays available without images.
+func (m *MergeService) addPreviewImages(uploadID string, session *models.UploadSession, merged *mergedFile) {
+	if err := m.extractPreviewImages(uploadID, session, merged); err != nil {
+		log.Printf("Preview image extraction failed for upload %s: %v", uploadID, err)
+	}
+}
+
+// extractPreviewImages writes the preview images of a merged video into ImagesDirName
+// and records their public paths in merged
+func (m *MergeService) extractPreviewImages(uploadID string, session *models.UploadSession, merged *mergedFile) error {
+	if merged.Media == nil || merged.Media.Video == nil || merged.Media.DurationSeconds <= 0 {
+		return fmt.Errorf("no probed video stream to take frames from")
+	}
+	duration := merged.Media.DurationSeconds
+
+	// Extract into a staging directory and swap it in so the old images stay whole until then
+	versionDir := filepath.Dir(merged.Path)
+	staging := filepath.Join(versionDir, imagesStagingPrefix+uploadID)
+	os.RemoveAll(staging)
+	defer os.RemoveAll(staging)
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	publicPath := func(file string) string {
+		return videoStreamPublicPath(session.LessonID, merged.FileID, merged.Version, ImagesDirName, file)
+	}
+	images := &models.VideoImages{}
+
+	// Poster at full resolution
+	if err := m.extractFrame(merged.Path, posterOffset(m.cfg.PosterOffsetSeconds, duration), 0, filepath.Join(staging, posterImage)); err != nil {
+		return fmt.Errorf("poster: %w", err)
+	}
+	images.Poster = publicPath(posterImage)
+
+	// Thumbnails spread evenly, skipping the very start and end where fades and titles sit
+	for i := 0; i < m.cfg.ThumbnailCount; i++ {
+		name := fmt.Sprintf(thumbnailFormat, i+1)
+		offset := duration * float64(i+1) / float64(m.cfg.ThumbnailCount+1)
+		if err := m.extractFrame(merged.Path, offset, m.cfg.ThumbnailWidth, filepath.Join(staging, name)); err != nil {
+			return fmt.Errorf("thumbnail %d: %w", i+1, err)
+		}
+		images.Thumbnails = append(images.Thumbnails, publicPath(name))
+	}
+
+	// Sprite sheet and its WebVTT index
+	width, height := merged.Media.Video.DisplaySize()
+	sheet := planSpriteSheet(duration, width, height, m.cfg.SpriteIntervalSeconds, m.cfg.SpriteTileWidth, m.cfg.SpriteColumns)
+	if err := m.extractSprite(merged.Path, sheet, filepath.Join(staging, spriteImage)); err != nil {
+		return fmt.Errorf("sprite: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, spriteVTT), []byte(spriteVTTIndex(sheet, duration, spriteImage)), 0644); err != nil {
+		return fmt.Errorf("failed to write sprite index: %w", err)
+	}
+	images.Sprite = publicPath(spriteImage)
+	images.SpriteVTT = publicPath(spriteVTT)
+
+	target := filepath.Join(versionDir, ImagesDirName)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, target); err != nil {
+		return fmt.Errorf("failed to move preview images into place: %w", err)
+	}
+
+	merged.Images = images
+	log.Printf("🖼️ Upload %s: poster, %d thumbnails and %d-tile sprite ready in %v",
+		uploadID, len(images.Thumbnails), sheet.Tiles, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// extractFrame writes the frame at offset (seconds) as a JPEG, scaled to width unless it is 0
+func (m *MergeService) extractFrame(src string, offset float64, width int, dst string) error {
+	args := []string{
+		// Seeking before the input jumps to the nearest keyframe instead of decoding up to offset
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", src,
+		"-map", "0:v:0",
+		"-frames:v", "1",
+	}
+	if width > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", width))
+	}
+	args = append(args, "-q:v", "3", dst)
+
+	if err := m.grabFFmpeg(args...); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); err != nil {
+		return fmt.Errorf("ffmpeg wrote no image at %.3fs", offset)
+	}
+	return nil
+}
+
+// extractSprite samples one frame per sheet interval and tiles them into a single JPEG
+func (m *MergeService) extractSprite(src string, sheet spriteSheet, dst string) error {
+	filter := fmt.Sprintf("fps=1/%d,scale=%d:%d,tile=%dx%d",
+		sheet.Interval, sheet.TileWidth, sheet.TileHeight, sheet.Columns, sheet.Rows)
+	args := []string{
+		"-i", src,
+		"-map", "0:v:0",
+		"-vf", filter,
+		"-frames:v", "1",
+		"-q:v", "5",
+		dst,
+	}
+	if err := m.encodeFFmpeg(args...); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); err != nil {
+		return fmt.Errorf("ffmpeg wrote no sprite sheet")
+	}
+	return nil
+}
+
+// posterOffset keeps the configured poster position inside the video
+func posterOffset(configured, duration float64) float64 {
+	if configured < 0 || configured >= duration {
+		return duration / 2
+	}
+	return configured
+}
+
+// planSpriteSheet lays out one tile per interval of the video, widening the interval
+// when the video would need more than spriteMaxTiles tiles
+func planSpriteSheet(duration float64, width, height, interval, tileWidth, columns int) spriteSheet {
+	if interval <= 0 {
+		interval = 10
+	}
+	if tileWidth <= 0 {
+		tileWidth = 160
+	}
+	if columns <= 0 {
+		columns = 10
+	}
+	if minimum := int(math.Ceil(duration / spriteMaxTiles)); interval < minimum {
+		interval = minimum
+	}
+
+	tiles := int(math.Ceil(duration / float64(interval)))
+	if tiles < 1 {
+		tiles = 1
+	}
+	if columns > tiles {
+		columns = tiles
+	}
+
+	tileHeight := tileWidth * 9 / 16
+	if width > 0 && height > 0 {
+		tileHeight = evenDimension(float64(tileWidth) * float64(height) / float64(width))
+	}
+
+	return spriteSheet{
+		Interval:   interval,
+		Tiles:      tiles,
+		Columns:    columns,
+		Rows:       (tiles + columns - 1) / columns,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+	}
+}
+
+// spriteVTTIndex writes one WebVTT cue per tile, pointing at it with a #xywh media fragment
+// relative to the VTT file
+func spriteVTTIndex(sheet spriteSheet, duration float64, image string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < sheet.Tiles; i++ {
+		start := float64(i * sheet.Interval)
+		end := math.Min(float64((i+1)*sheet.Interval), duration)
+		x := (i % sheet.Columns) * sheet.TileWidth
+		y := (i / sheet.Columns) * sheet.TileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			utils.VTTTimestamp(start), utils.VTTTimestamp(end), image, x, y, sheet.TileWidth, sheet.TileHeight)
+	}
+	return b.String()
+}
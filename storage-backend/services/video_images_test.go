@@ -0,0 +1,71 @@
+package services
+
+import "testing"
+
+func TestPlanSpriteSheet(t *testing.T) {
+	cases := []struct {
+		name                      string
+		duration                  float64
+		width, height             int
+		interval, tileWidth, cols int
+		want                      spriteSheet
+	}{
+		{"shorter than one interval", 3.5, 1280, 720, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 1, Columns: 1, Rows: 1, TileWidth: 160, TileHeight: 90}},
+		{"fewer tiles than columns", 45, 1280, 720, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 5, Columns: 5, Rows: 1, TileWidth: 160, TileHeight: 90}},
+		{"zero duration", 0, 1280, 720, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 1, Columns: 1, Rows: 1, TileWidth: 160, TileHeight: 90}},
+		{"exact interval boundary", 30, 1280, 720, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 3, Columns: 3, Rows: 1, TileWidth: 160, TileHeight: 90}},
+		{"just past a boundary", 30.001, 1280, 720, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 4, Columns: 4, Rows: 1, TileWidth: 160, TileHeight: 90}},
+		{"partial last row", 250, 1280, 720, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 25, Columns: 10, Rows: 3, TileWidth: 160, TileHeight: 90}},
+		{"exactly the tile limit", 4000, 1280, 720, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 400, Columns: 10, Rows: 40, TileWidth: 160, TileHeight: 90}},
+		{"interval widened past the tile limit", 8000, 1280, 720, 10, 160, 10, spriteSheet{Interval: 20, Tiles: 400, Columns: 10, Rows: 40, TileWidth: 160, TileHeight: 90}},
+		{"portrait video", 10, 720, 1280, 10, 160, 10, spriteSheet{Interval: 10, Tiles: 1, Columns: 1, Rows: 1, TileWidth: 160, TileHeight: 284}},
+		{"defaults and unknown dimensions", 100, 0, 0, 0, 0, 0, spriteSheet{Interval: 10, Tiles: 10, Columns: 10, Rows: 1, TileWidth: 160, TileHeight: 90}},
+	}
+
+	for _, tc := range cases {
+		got := planSpriteSheet(tc.duration, tc.width, tc.height, tc.interval, tc.tileWidth, tc.cols)
+		if got != tc.want {
+			t.Errorf("%s: planSpriteSheet = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSpriteVTTIndex(t *testing.T) {
+	cases := []struct {
+		name     string
+		duration float64
+		columns  int
+		want     string
+	}{
+		{
+			name:     "tiles wrap to the next row",
+			duration: 25,
+			columns:  2,
+			want: "WEBVTT\n" +
+				"\n00:00:00.000 --> 00:00:10.000\nsprite.jpg#xywh=0,0,160,90\n" +
+				"\n00:00:10.000 --> 00:00:20.000\nsprite.jpg#xywh=160,0,160,90\n" +
+				"\n00:00:20.000 --> 00:00:25.000\nsprite.jpg#xywh=0,90,160,90\n",
+		},
+		{
+			name:     "last cue ends on an interval boundary",
+			duration: 20,
+			columns:  10,
+			want: "WEBVTT\n" +
+				"\n00:00:00.000 --> 00:00:10.000\nsprite.jpg#xywh=0,0,160,90\n" +
+				"\n00:00:10.000 --> 00:00:20.000\nsprite.jpg#xywh=160,0,160,90\n",
+		},
+		{
+			name:     "video shorter than one interval",
+			duration: 3.5,
+			columns:  10,
+			want:     "WEBVTT\n\n00:00:00.000 --> 00:00:03.500\nsprite.jpg#xywh=0,0,160,90\n",
+		},
+	}
+
+	for _, tc := range cases {
+		sheet := planSpriteSheet(tc.duration, 1280, 720, 10, 160, tc.columns)
+		if got := spriteVTTIndex(sheet, tc.duration, "sprite.jpg"); got != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"storage-backend/models"
+	"storage-backend/utils"
+)
+
+// decodeCheckSeconds is how much of the start and the end of a video is decoded during validation
+const decodeCheckSeconds = 2.0
+
+// Codecs and pixel formats every major browser plays from an MP4
+var (
+	playableVideoCodecs  = map[string]bool{"h264": true}
+	playablePixelFormats = map[string]bool{"yuv420p": true, "yuvj420p": true}
+	playableAudioCodecs  = map[string]bool{"aac": true, "mp3": true}
+)
+
+// VideoValidationError explains why an uploaded video cannot go live.
+// Code is one of the models.UploadError constants and Message is safe to show to the uploader.
+type VideoValidationError struct {
+	Code    string
+	Message string
+	Err     error // Underlying ffprobe/ffmpeg failure, if any
+}
+
+func (e *VideoValidationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *VideoValidationError) Unwrap() error {
+	return e.Err
+}
+
+// validateVideo checks that the file at path is a browser-playable MP4: the container
+// signature, the streams reported by ffprobe and a decode of the first and last seconds.
+// media may carry an earlier probe of the same file. It returns the probed media details on success.
+func (m *MergeService) validateVideo(path string, media *models.MediaInfo) (*models.MediaInfo, error) {
+	brand, err := utils.MP4Brand(path)
+	if err != nil {
+		return nil, &VideoValidationError{Code: models.UploadErrorNotMP4, Message: "the uploaded file is not an MP4 video", Err: err}
+	}
+	if brand == "qt  " {
+		return nil, &VideoValidationError{Code: models.UploadErrorNotMP4, Message: "the uploaded file is a QuickTime movie, not an MP4 video"}
+	}
+
+	if media == nil {
+		if media, err = m.probeMedia(path); err != nil {
+			return nil, mediaError(models.UploadErrorCorruptVideo, "the uploaded video could not be read, it may be damaged or incomplete", err)
+		}
+	}
+	if err := checkPlayableStreams(media); err != nil {
+		return nil, err
+	}
+
+	// A truncated upload usually still probes fine; decoding the tail catches it
+	if err := m.decodeCheck(path, 0, decodeCheckSeconds); err != nil {
+		return nil, mediaError(models.UploadErrorCorruptVideo, "the beginning of the uploaded video could not be decoded", err)
+	}
+	if tail := media.DurationSeconds - decodeCheckSeconds; tail > 0 {
+		if err := m.decodeCheck(path, tail, decodeCheckSeconds); err != nil {
+			return nil, mediaError(models.UploadErrorCorruptVideo, "the end of the uploaded video could not be decoded, the upload may be incomplete", err)
+		}
+	}
+
+	return media, nil
+}
+
+// mediaError rejects the upload with code and message when ffmpeg/ffprobe failed on the file itself.
+// When the tool could not run at all the file says nothing about the upload, so the plain error is
+// returned instead: the session fails as processing_failed and keeps its parts for a retry.
+func mediaError(code, message string, err error) error {
+	if errors.Is(err, utils.ErrToolFailed) {
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	return &VideoValidationError{Code: code, Message: message, Err: err}
+}
+
+// checkPlayableStreams rejects videos whose streams browsers cannot play
+func checkPlayableStreams(media *models.MediaInfo) error {
+	if media.DurationSeconds <= 0 {
+		return &VideoValidationError{Code: models.UploadErrorCorruptVideo, Message: "the uploaded video has no duration, it may be damaged or incomplete"}
+	}
+
+	video := media.Video
+	if video == nil {
+		return &VideoValidationError{Code: models.UploadErrorNoVideoStream, Message: "the uploaded file does not contain a video track"}
+	}
+	if !playableVideoCodecs[video.Codec] {
+		return &VideoValidationError{Code: models.UploadErrorUnsupportedCodec, Message: fmt.Sprintf("video codec %q is not supported, please upload H.264 video", video.Codec)}
+	}
+	if !playablePixelFormats[video.PixelFormat] {
+		return &VideoValidationError{Code: models.UploadErrorUnsupportedCodec, Message: fmt.Sprintf("pixel format %q is not supported by browsers, please export as yuv420p", video.PixelFormat)}
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return &VideoValidationError{Code: models.UploadErrorCorruptVideo, Message: "the video track has no resolution, it may be damaged"}
+	}
+
+	for _, audio := range media.Audio {
+		if !playableAudioCodecs[audio.Codec] {
+			return &VideoValidationError{Code: models.UploadErrorUnsupportedCodec, Message: fmt.Sprintf("audio codec %q is not supported, please upload AAC audio", audio.Codec)}
+		}
+	}
+	return nil
+}
+
+// failureCode picks the error code recorded on a session that failed with err
+func failureCode(err error) string {
+	var validationErr *VideoValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	var captionErr *CaptionValidationError
+	if errors.As(err, &captionErr) {
+		return models.UploadErrorInvalidCaptions
+	}
+	return models.UploadErrorProcessingFailed
+}
+
+// failureMessage is the session error shown to the uploader; internal details only go to the log
+func failureMessage(err error) string {
+	var validationErr *VideoValidationError
+	if errors.As(err, &validationErr) {
+		if validationErr.Err != nil {
+			log.Printf("Video validation failed: %v", validationErr.Err)
+		}
+		return validationErr.Message
+	}
+	var captionErr *CaptionValidationError
+	if errors.As(err, &captionErr) {
+		return captionErr.Message
+	}
+	if errors.Is(err, utils.ErrToolFailed) {
+		log.Printf("Video processing tools failed: %v", err)
+		return "the video could not be processed right now, please complete the upload again later"
+	}
+	return err.Error()
+}
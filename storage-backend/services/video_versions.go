@@ -0,0 +1,302 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"storage-backend/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every upload of a video is stored as its own version:
+//
+//	videos/<lesson_id>/<video_id>/v<N>/video.mp4
+//	videos/<lesson_id>/<video_id>/current.meta.json  -> {"version": N}
+//
+// Old versions stay on disk so in-flight Range requests and CDN caches keep
+// working, and the pointer only moves once a new version is fully written.
+// Videos stored before versioning have video.mp4 directly in the video
+// directory and are treated as version 0.
+
+// CurrentVersionFile is the pointer file in a video directory. The sidecar suffix
+// keeps nginx from serving it and directory scans from treating it as content.
+const CurrentVersionFile = "current" + MetadataSuffix
+
+const versionPrefix = "v"
+
+// errVersionSuperseded rejects publishing a version older than the one the video already points at
+var errVersionSuperseded = errors.New("a newer version of the video is already live")
+
+// videoDirLock serializes pointer changes of one video directory
+type videoDirLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var (
+	videoDirLocksMu sync.Mutex
+	videoDirLocks   = make(map[string]*videoDirLock)
+)
+
+// lockVideoDir locks the version pointer of a video against concurrent publishes and rollbacks
+// and returns the function that unlocks it
+func lockVideoDir(videoDir string) func() {
+	videoDirLocksMu.Lock()
+	lock := videoDirLocks[videoDir]
+	if lock == nil {
+		lock = &videoDirLock{}
+		videoDirLocks[videoDir] = lock
+	}
+	lock.refs++
+	videoDirLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		videoDirLocksMu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(videoDirLocks, videoDir)
+		}
+		videoDirLocksMu.Unlock()
+	}
+}
+
+// VersionDirName returns the directory name of a video version
+func VersionDirName(version int) string {
+	return versionPrefix + strconv.Itoa(version)
+}
+
+// versionedVideoPath returns where a version of a video is stored; version 0 is unversioned
+func versionedVideoPath(videoDir string, version int) string {
+	if version == 0 {
+		return filepath.Join(videoDir, VideoFilename)
+	}
+	return filepath.Join(videoDir, VersionDirName(version), VideoFilename)
+}
+
+// listVideoVersions returns the stored versions of a video in ascending order
+func listVideoVersions(videoDir string) ([]int, error) {
+	entries, err := os.ReadDir(videoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			if entry.Name() == VideoFilename {
+				versions = append(versions, 0)
+			}
+			continue
+		}
+		if version, ok := parseVersionDir(entry.Name()); ok {
+			if _, err := os.Stat(versionedVideoPath(videoDir, version)); err == nil {
+				versions = append(versions, version)
+			}
+		}
+	}
+
+	sort.Ints(versions)
+	return versions, nil
+}
+
+func parseVersionDir(name string) (int, bool) {
+	if !strings.HasPrefix(name, versionPrefix) {
+		return 0, false
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(name, versionPrefix))
+	if err != nil || version <= 0 || VersionDirName(version) != name {
+		return 0, false
+	}
+	return version, true
+}
+
+// currentVideoVersion reads the pointer of a video. Without a pointer the
+// newest stored version is current.
+func currentVideoVersion(videoDir string) (int, error) {
+	version, err := pointedVideoVersion(videoDir)
+	if err == nil || !os.IsNotExist(err) {
+		return version, err
+	}
+
+	versions, err := listVideoVersions(videoDir)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, os.ErrNotExist
+	}
+	return versions[len(versions)-1], nil
+}
+
+// pointedVideoVersion reads the version pointer of a video; os.IsNotExist reports a missing pointer
+func pointedVideoVersion(videoDir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(videoDir, CurrentVersionFile))
+	if err != nil {
+		return 0, err
+	}
+	var pointer models.VideoPointer
+	if err := json.Unmarshal(data, &pointer); err != nil {
+		return 0, fmt.Errorf("invalid version pointer in %s: %w", videoDir, err)
+	}
+	return pointer.Version, nil
+}
+
+// claimNextVideoVersion creates the directory for the next version of a video.
+// os.Mkdir fails if another merge claimed the same number first, so it retries with the next one.
+func claimNextVideoVersion(videoDir string) (int, string, error) {
+	if err := os.MkdirAll(videoDir, 0755); err != nil {
+		return 0, "", err
+	}
+
+	versions, err := listVideoVersions(videoDir)
+	if err != nil {
+		return 0, "", err
+	}
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+
+	for attempt := 0; attempt < 100; attempt++ {
+		dir := filepath.Join(videoDir, VersionDirName(next))
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return next, dir, nil
+		}
+		if !os.IsExist(err) {
+			return 0, "", err
+		}
+		next++
+	}
+	return 0, "", fmt.Errorf("could not claim a version directory in %s", videoDir)
+}
+
+// advanceVideoVersion points the video at version unless it already points at that version or
+// a newer one, which happens when a later upload of the same video finished processing first.
+// Rollbacks go through setCurrentVideoVersion instead.
+func advanceVideoVersion(videoDir string, version int) (*models.VideoPointer, error) {
+	unlock := lockVideoDir(videoDir)
+	defer unlock()
+
+	// Only the pointer counts: without one, the newest version on disk is the one being published
+	current, err := pointedVideoVersion(videoDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil && current >= version {
+		return nil, fmt.Errorf("%w: v%d, not publishing v%d", errVersionSuperseded, current, version)
+	}
+	return setCurrentVideoVersion(videoDir, version)
+}
+
+// rollbackVideoVersion points the video back at an earlier version and returns the version it
+// pointed at before. Version 0 selects the newest version older than the current one.
+func rollbackVideoVersion(videoDir string, version int) (int, *models.VideoPointer, error) {
+	// Publishes of new uploads must not interleave with choosing and setting the target
+	unlock := lockVideoDir(videoDir)
+	defer unlock()
+
+	current, err := currentVideoVersion(videoDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, ErrVideoNotFound
+		}
+		return 0, nil, err
+	}
+	versions, err := listVideoVersions(videoDir)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	target := -1
+	for _, v := range versions {
+		if (version != 0 && v == version) || (version == 0 && v < current) {
+			target = v
+		}
+	}
+	if target < 0 {
+		return 0, nil, ErrVersionNotFound
+	}
+
+	pointer, err := setCurrentVideoVersion(videoDir, target)
+	if err != nil {
+		return 0, nil, err
+	}
+	return current, pointer, nil
+}
+
+// expiredVideoVersions returns the versions older than current beyond the newest keep versions
+// (current included); versions newer than current may still be publishing and are never returned
+func expiredVideoVersions(videoDir string, keep int) ([]int, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	unlock := lockVideoDir(videoDir)
+	defer unlock()
+
+	current, err := currentVideoVersion(videoDir)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := listVideoVersions(videoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var older []int
+	for _, version := range versions {
+		if version < current {
+			older = append(older, version)
+		}
+	}
+	if len(older) <= keep-1 {
+		return nil, nil
+	}
+	return older[:len(older)-(keep-1)], nil
+}
+
+// setCurrentVideoVersion atomically points the video at version
+func setCurrentVideoVersion(videoDir string, version int) (*models.VideoPointer, error) {
+	pointer := &models.VideoPointer{Version: version, UpdatedAt: time.Now()}
+	if previous, err := currentVideoVersion(videoDir); err == nil && previous != version {
+		pointer.PreviousVersion = previous
+	}
+
+	data, err := json.MarshalIndent(pointer, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(videoDir, ".current-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create version pointer: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write version pointer: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write version pointer: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write version pointer: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write version pointer: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(videoDir, CurrentVersionFile)); err != nil {
+		return nil, fmt.Errorf("failed to switch video version: %w", err)
+	}
+	return pointer, nil
+}
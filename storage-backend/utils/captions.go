@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Timing lines: SRT uses a comma before the milliseconds, WebVTT a dot and optional hours.
+// Anything after the end time (SRT coordinates, WebVTT cue settings) is captured separately.
+var (
+	srtTimingLine = regexp.MustCompile(`^\s*(\d+:)?(\d{1,2}):(\d{1,2})[,.](\d{1,3})\s*-->\s*(\d+:)?(\d{1,2}):(\d{1,2})[,.](\d{1,3})(.*)$`)
+	vttTimingLine = regexp.MustCompile(`^(\d{2,}:)?(\d{2}):(\d{2})\.(\d{3})[ \t]+-->[ \t]+(\d{2,}:)?(\d{2}):(\d{2})\.(\d{3})([ \t].*)?$`)
+
+	// SRT styling WebVTT has no equivalent for: <font> tags and ASS overrides such as {\an8}
+	srtUnsupportedTags = regexp.MustCompile(`(?i)</?font[^>]*>|\{\\[^}]*\}`)
+
+	// SRT styling kept as WebVTT markup; any other "<" is text
+	srtAllowedTag = regexp.MustCompile(`(?i)^</?[ibu]>`)
+)
+
+// ToWebVTT returns captions as WebVTT. WebVTT input is checked and returned with normalized line
+// endings; anything else is parsed as SRT and converted, which converted reports.
+// Errors describe the problem in terms the uploader can act on.
+func ToWebVTT(data []byte) (vtt []byte, converted bool, err error) {
+	text, err := captionText(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if isWebVTT(text) {
+		if err := checkWebVTT(text); err != nil {
+			return nil, false, err
+		}
+		return []byte(strings.TrimRight(text, "\n") + "\n"), false, nil
+	}
+
+	vtt, err = srtToWebVTT(text)
+	if err != nil {
+		return nil, false, err
+	}
+	return vtt, true, nil
+}
+
+// captionText decodes a caption file as UTF-8 without a byte order mark and with \n line endings
+func captionText(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("captions must be UTF-8 encoded")
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n"), nil
+}
+
+// isWebVTT reports whether text starts with the WebVTT signature line
+func isWebVTT(text string) bool {
+	if !strings.HasPrefix(text, "WEBVTT") {
+		return false
+	}
+	rest := text[len("WEBVTT"):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n'
+}
+
+// checkWebVTT verifies that every cue of a WebVTT file has a valid timing line and that there is at least one
+func checkWebVTT(text string) error {
+	cues := 0
+	for i, block := range captionBlocks(text) {
+		if i == 0 {
+			continue // Signature and header
+		}
+		lines := strings.Split(block, "\n")
+		if strings.HasPrefix(lines[0], "NOTE") || lines[0] == "STYLE" || lines[0] == "REGION" {
+			continue
+		}
+
+		// An optional cue identifier precedes the timing line
+		timing := lines[0]
+		if !strings.Contains(timing, "-->") && len(lines) > 1 {
+			timing = lines[1]
+		}
+		match := vttTimingLine.FindStringSubmatch(timing)
+		if match == nil {
+			return fmt.Errorf("cue %d: invalid timing line %q", cues+1, timing)
+		}
+		if err := checkCueTimes(cues+1, captionMillis(match[1:5]), captionMillis(match[5:9])); err != nil {
+			return err
+		}
+		cues++
+	}
+	if cues == 0 {
+		return fmt.Errorf("no cues found")
+	}
+	return nil
+}
+
+// srtToWebVTT converts SRT cues to WebVTT, dropping cue numbers, SRT coordinates and unsupported styling
+func srtToWebVTT(text string) ([]byte, error) {
+	var out strings.Builder
+	out.WriteString("WEBVTT\n")
+
+	cues := 0
+	for _, block := range captionBlocks(text) {
+		lines := strings.Split(block, "\n")
+
+		// The cue number is optional in practice
+		if len(lines) > 1 && isDigits(strings.TrimSpace(lines[0])) {
+			lines = lines[1:]
+		}
+		match := srtTimingLine.FindStringSubmatch(lines[0])
+		if match == nil {
+			return nil, fmt.Errorf("cue %d: invalid timing line %q", cues+1, lines[0])
+		}
+		start, end := captionMillis(match[1:5]), captionMillis(match[5:9])
+		if err := checkCueTimes(cues+1, start, end); err != nil {
+			return nil, err
+		}
+		cues++
+
+		fmt.Fprintf(&out, "\n%s --> %s\n", VTTTimestamp(float64(start)/1000), VTTTimestamp(float64(end)/1000))
+		for _, line := range lines[1:] {
+			line = srtUnsupportedTags.ReplaceAllString(line, "")
+			// "-->" inside cue text would end the cue in WebVTT
+			out.WriteString(escapeCueText(strings.ReplaceAll(line, "-->", "->")) + "\n")
+		}
+	}
+	if cues == 0 {
+		return nil, fmt.Errorf("no cues found")
+	}
+	return []byte(out.String()), nil
+}
+
+// escapeCueText escapes "&" and "<" in SRT cue text so WebVTT players show them as text,
+// keeping the italic, bold and underline tags both formats share
+func escapeCueText(line string) string {
+	var out strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '&':
+			out.WriteString("&amp;")
+		case '<':
+			if tag := srtAllowedTag.FindString(line[i:]); tag != "" {
+				// WebVTT tags are case sensitive
+				out.WriteString(strings.ToLower(tag))
+				i += len(tag) - 1
+				continue
+			}
+			out.WriteString("&lt;")
+		default:
+			out.WriteByte(line[i])
+		}
+	}
+	return out.String()
+}
+
+// checkCueTimes rejects cues that end before they start
+func checkCueTimes(cue int, start, end int64) error {
+	if end < start {
+		return fmt.Errorf("cue %d: ends at %s before it starts at %s", cue, VTTTimestamp(float64(end)/1000), VTTTimestamp(float64(start)/1000))
+	}
+	return nil
+}
+
+// captionBlocks splits caption text into blocks separated by blank lines
+func captionBlocks(text string) []string {
+	var blocks []string
+	var current []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, strings.Join(current, "\n"))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, strings.Join(current, "\n"))
+	}
+	return blocks
+}
+
+// captionMillis converts matched hours (with colon, may be empty), minutes, seconds and
+// milliseconds to milliseconds; a short fraction such as "5" means 500 ms
+func captionMillis(parts []string) int64 {
+	hours, _ := strconv.ParseInt(strings.TrimSuffix(parts[0], ":"), 10, 64)
+	minutes, _ := strconv.ParseInt(parts[1], 10, 64)
+	seconds, _ := strconv.ParseInt(parts[2], 10, 64)
+	fraction := (parts[3] + "00")[:3]
+	millis, _ := strconv.ParseInt(fraction, 10, 64)
+	return ((hours*60+minutes)*60+seconds)*1000 + millis
+}
+
+// VTTTimestamp formats seconds as a WebVTT timestamp (hh:mm:ss.mmm)
+func VTTTimestamp(seconds float64) string {
+	millis := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToWebVTTFromSRT(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string // Converted WebVTT; empty when conversion must fail
+		err   string // Substring of the expected error
+	}{
+		{
+			name:  "single cue",
+			input: "1\n00:00:01,000 --> 00:00:02,500\nHello\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\n",
+		},
+		{
+			name:  "CRLF line endings",
+			input: "1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\nworld\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nAgain\r\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\nworld\n\n00:00:03.000 --> 00:00:04.000\nAgain\n",
+		},
+		{
+			name:  "byte order mark",
+			input: "\xef\xbb\xbf1\n00:00:01,000 --> 00:00:02,000\nHello\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nHello\n",
+		},
+		{
+			name:  "dot before milliseconds",
+			input: "1\n00:00:01.250 --> 00:00:02.750\nHello\n",
+			want:  "WEBVTT\n\n00:00:01.250 --> 00:00:02.750\nHello\n",
+		},
+		{
+			name:  "short fraction",
+			input: "1\n0:0:1,5 --> 0:0:2,25\nHello\n",
+			want:  "WEBVTT\n\n00:00:01.500 --> 00:00:02.250\nHello\n",
+		},
+		{
+			name:  "missing cue indices",
+			input: "00:00:01,000 --> 00:00:02,000\nOne\n\n00:00:03,000 --> 00:00:04,000\nTwo\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nOne\n\n00:00:03.000 --> 00:00:04.000\nTwo\n",
+		},
+		{
+			name:  "coordinates and unsupported styling dropped",
+			input: "1\n00:00:01,000 --> 00:00:02,000 X1:10 X2:20 Y1:30 Y2:40\n{\\an8}<font color=\"red\">Top</font>\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nTop\n",
+		},
+		{
+			name:  "markup characters escaped",
+			input: "1\n00:00:01,000 --> 00:00:02,000\nTom & Jerry say 1 < 2 <3\n<I>slanted</I> <b>bold</b> <u>under</u> <c>not a tag</c>\nnext --> cue\n",
+			want:  "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nTom &amp; Jerry say 1 &lt; 2 &lt;3\n<i>slanted</i> <b>bold</b> <u>under</u> &lt;c>not a tag&lt;/c>\nnext -> cue\n",
+		},
+		{
+			name:  "malformed timing",
+			input: "1\n00:00:01 --> 00:00:02\nHello\n",
+			err:   `cue 1: invalid timing line "00:00:01 --> 00:00:02"`,
+		},
+		{
+			name:  "malformed timing in a later cue",
+			input: "1\n00:00:01,000 --> 00:00:02,000\nOne\n\n2\n00:00:03,000 -> 00:00:04,000\nTwo\n",
+			err:   "cue 2: invalid timing line",
+		},
+		{
+			name:  "text without timing",
+			input: "just some text\n",
+			err:   "cue 1: invalid timing line",
+		},
+		{
+			name:  "ends before it starts",
+			input: "1\n00:00:05,000 --> 00:00:04,000\nHello\n",
+			err:   "cue 1: ends at 00:00:04.000 before it starts at 00:00:05.000",
+		},
+		{
+			name:  "empty file",
+			input: "\n\n",
+			err:   "no cues found",
+		},
+		{
+			name:  "invalid UTF-8",
+			input: "1\n00:00:01,000 --> 00:00:02,000\n\xff\xfe\n",
+			err:   "UTF-8",
+		},
+	}
+
+	for _, tc := range cases {
+		vtt, converted, err := ToWebVTT([]byte(tc.input))
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: error = %v, want one containing %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: conversion failed: %v", tc.name, err)
+			continue
+		}
+		if !converted {
+			t.Errorf("%s: input was not reported as converted", tc.name)
+		}
+		if string(vtt) != tc.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", tc.name, vtt, tc.want)
+		}
+	}
+}
+
+func TestToWebVTTPassesWebVTTThrough(t *testing.T) {
+	input := "WEBVTT\r\n\r\nintro\r\n00:00:01.000 --> 00:00:02.000 align:start\r\nA &amp; B\r\n"
+	vtt, converted, err := ToWebVTT([]byte(input))
+	if err != nil {
+		t.Fatalf("WebVTT input rejected: %v", err)
+	}
+	if converted {
+		t.Error("WebVTT input reported as converted")
+	}
+	if want := "WEBVTT\n\nintro\n00:00:01.000 --> 00:00:02.000 align:start\nA &amp; B\n"; string(vtt) != want {
+		t.Errorf("got %q, want %q", vtt, want)
+	}
+}
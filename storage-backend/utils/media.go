@@ -1,34 +1,269 @@
 package utils
 
 import (
-	"math"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"storage-backend/models"
 	"strconv"
 	"strings"
 )
 
-// GetVideoDurationInSeconds returns the duration of the given video file by invoking ffprobe.
-// It rounds the duration to the nearest whole second.
-func GetVideoDurationInSeconds(ffprobePath, path string) (int, error) {
-	cmd := exec.Command(ffprobePath, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path)
-	output, err := cmd.Output()
+// MP4Brand returns the major brand of an ISO base media file (e.g. "isom", "mp42", "qt  ").
+// It fails when the file does not start with an ftyp box.
+func MP4Brand(path string) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
+	defer file.Close()
 
-	durationStr := strings.TrimSpace(string(output))
-	if durationStr == "" {
-		return 0, nil
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return "", fmt.Errorf("file too short for an MP4 header: %w", err)
+	}
+	if string(header[4:8]) != "ftyp" {
+		return "", fmt.Errorf("missing ftyp box, file starts with %q", header[4:8])
 	}
+	return string(header[8:12]), nil
+}
+
+// ErrToolFailed marks an ffmpeg or ffprobe failure caused by the environment rather than the input:
+// the binary is missing or cannot start, the process was killed (e.g. by the OOM killer) or it
+// ran past its deadline
+var ErrToolFailed = errors.New("media tool did not run to completion")
 
-	duration, err := strconv.ParseFloat(durationStr, 64)
+// toolError describes a failed ffmpeg/ffprobe run, wrapping ErrToolFailed unless the tool
+// exited on its own, which means it rejected the input
+func toolError(ctx context.Context, what string, err error, output []byte) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%s: %w: %v", what, ErrToolFailed, ctxErr)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() == -1 {
+		return fmt.Errorf("%s: %w: %v", what, ErrToolFailed, err)
+	}
+	if len(output) > 0 {
+		return fmt.Errorf("%s: %s", what, strings.TrimSpace(string(output)))
+	}
+	return fmt.Errorf("%s: %w", what, err)
+}
+
+// RunFFmpeg runs ffmpeg with args, returning its error output on failure.
+// The process is killed when ctx is done.
+func RunFFmpeg(ctx context.Context, ffmpegPath string, args ...string) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath, append([]string{"-v", "error", "-nostdin", "-y"}, args...)...)
+	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return 0, err
+		return toolError(ctx, "ffmpeg failed", err, output)
+	}
+	return nil
+}
+
+// RunFFmpegProgress runs ffmpeg like RunFFmpeg and reports the percentage of duration
+// (seconds) processed so far to onProgress as ffmpeg writes its progress lines
+func RunFFmpegProgress(ctx context.Context, ffmpegPath string, duration float64, onProgress func(percent float64), args ...string) error {
+	args = append([]string{"-v", "error", "-nostdin", "-y", "-progress", "pipe:1", "-nostats"}, args...)
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return toolError(ctx, "ffmpeg failed to start", err, nil)
 	}
 
-	if duration < 0 {
-		duration = 0
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// out_time_us (and the misnamed out_time_ms) are microseconds
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found || (key != "out_time_us" && key != "out_time_ms") || duration <= 0 {
+			continue
+		}
+		if micros, err := strconv.ParseInt(value, 10, 64); err == nil && micros >= 0 {
+			percent := float64(micros) / 1e6 / duration * 100
+			if percent > 100 {
+				percent = 100
+			}
+			onProgress(percent)
+		}
 	}
 
-	return int(math.Round(duration)), nil
+	if err := cmd.Wait(); err != nil {
+		return toolError(ctx, "ffmpeg failed", err, stderr.Bytes())
+	}
+	return nil
+}
+
+// DecodeCheck decodes length seconds of path starting at start and fails on the first decoding error
+func DecodeCheck(ctx context.Context, ffmpegPath, path string, start, length float64) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-v", "error", "-xerror",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-t", strconv.FormatFloat(length, 'f', 3, 64),
+		"-i", path, "-f", "null", "-")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return toolError(ctx, "ffmpeg decode failed", err, output)
+	}
+	return nil
+}
+
+// ffprobeOutput is the subset of `ffprobe -print_format json -show_format -show_streams` we read
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []ffprobeStream `json:"streams"`
+}
+
+type ffprobeStream struct {
+	CodecType     string            `json:"codec_type"`
+	CodecName     string            `json:"codec_name"`
+	Profile       string            `json:"profile"`
+	PixFmt        string            `json:"pix_fmt"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	RFrameRate    string            `json:"r_frame_rate"`
+	AvgFrameRate  string            `json:"avg_frame_rate"`
+	BitRate       string            `json:"bit_rate"`
+	Channels      int               `json:"channels"`
+	ChannelLayout string            `json:"channel_layout"`
+	SampleRate    string            `json:"sample_rate"`
+	Tags          map[string]string `json:"tags"`
+	Disposition   map[string]int    `json:"disposition"`
+	SideDataList  []struct {
+		SideDataType string  `json:"side_data_type"`
+		Rotation     float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// ProbeMedia runs ffprobe on path and returns its container and stream details
+func ProbeMedia(ctx context.Context, ffprobePath, path string) (*models.MediaInfo, error) {
+	cmd := exec.CommandContext(ctx, ffprobePath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	output, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		return nil, toolError(ctx, "ffprobe failed", err, stderr)
+	}
+
+	return ParseProbeOutput(output)
+}
+
+// ParseProbeOutput converts ffprobe JSON output into MediaInfo
+func ParseProbeOutput(output []byte) (*models.MediaInfo, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	info := &models.MediaInfo{
+		Container:       probe.Format.FormatName,
+		DurationSeconds: parseFloat(probe.Format.Duration),
+		BitRate:         parseInt(probe.Format.BitRate),
+	}
+
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "video":
+			// Cover art is reported as a video stream; skip it
+			if info.Video != nil || stream.Disposition["attached_pic"] == 1 {
+				continue
+			}
+			info.Video = &models.VideoStreamInfo{
+				Codec:       stream.CodecName,
+				Profile:     stream.Profile,
+				PixelFormat: stream.PixFmt,
+				Width:       stream.Width,
+				Height:      stream.Height,
+				FrameRate:   streamFrameRate(stream),
+				BitRate:     parseInt(stream.BitRate),
+				Rotation:    streamRotation(stream),
+			}
+		case "audio":
+			info.Audio = append(info.Audio, models.AudioStreamInfo{
+				Codec:         stream.CodecName,
+				Channels:      stream.Channels,
+				ChannelLayout: stream.ChannelLayout,
+				SampleRate:    int(parseInt(stream.SampleRate)),
+				BitRate:       parseInt(stream.BitRate),
+				Language:      stream.Tags["language"],
+			})
+		}
+	}
+
+	return info, nil
+}
+
+// streamFrameRate prefers the average frame rate, which is what variable frame rate phone recordings report sensibly
+func streamFrameRate(stream ffprobeStream) float64 {
+	if rate := parseRational(stream.AvgFrameRate); rate > 0 {
+		return rate
+	}
+	return parseRational(stream.RFrameRate)
+}
+
+// streamRotation reads the rotation from the legacy "rotate" tag or the display
+// matrix side data (newer ffmpeg, counter-clockwise) and normalizes it to clockwise 0-359
+func streamRotation(stream ffprobeStream) int {
+	rotation := 0
+	if tag, ok := stream.Tags["rotate"]; ok {
+		rotation = int(parseInt(tag))
+	} else {
+		for _, side := range stream.SideDataList {
+			if side.SideDataType == "Display Matrix" {
+				rotation = -int(side.Rotation)
+				break
+			}
+		}
+	}
+
+	rotation %= 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	return rotation
+}
+
+// parseRational parses ffprobe rates like "30000/1001"; "0/0" yields 0
+func parseRational(value string) float64 {
+	num, den, found := strings.Cut(value, "/")
+	if !found {
+		return parseFloat(value)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	rate := parseFloat(num) / d
+	return float64(int64(rate*1000+0.5)) / 1000
+}
+
+func parseFloat(value string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+	return f
+}
+
+func parseInt(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
 }
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunFFmpegToolFailures(t *testing.T) {
+	dir := t.TempDir()
+	script := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	cases := []struct {
+		name       string
+		ffmpeg     string
+		toolFailed bool // Environment failure rather than a rejected input
+	}{
+		{"missing binary", filepath.Join(dir, "no-ffmpeg"), true},
+		{"not executable", filepath.Join(dir, "plain"), true},
+		{"killed", script("killed", "kill -9 $$"), true},
+		{"rejects input", script("rejects", "echo 'Invalid data found when processing input' >&2; exit 1"), false},
+	}
+	if err := os.WriteFile(filepath.Join(dir, "plain"), []byte("not a program"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range cases {
+		err := RunFFmpeg(context.Background(), tc.ffmpeg, "-i", "input.mp4", "out.mp4")
+		if err == nil {
+			t.Errorf("%s: RunFFmpeg succeeded", tc.name)
+			continue
+		}
+		if got := errors.Is(err, ErrToolFailed); got != tc.toolFailed {
+			t.Errorf("%s: errors.Is(%v, ErrToolFailed) = %v, want %v", tc.name, err, got, tc.toolFailed)
+		}
+	}
+
+	// A hanging run is killed at the deadline and counts as a tool failure
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := RunFFmpeg(ctx, script("hangs", "exec sleep 10"))
+	if !errors.Is(err, ErrToolFailed) {
+		t.Errorf("hanging run: errors.Is(%v, ErrToolFailed) = false, want true", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hanging run returned after %v, want it killed at the deadline", elapsed)
+	}
+}
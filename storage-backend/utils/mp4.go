@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// maxMoovSize caps how much of a moov box is loaded into memory for rewriting
+const maxMoovSize = 256 << 20
+
+// ErrNotFaststartable is returned for files whose layout Faststart does not rewrite
+var ErrNotFaststartable = errors.New("mp4 layout not supported for faststart")
+
+// mp4Box is a top-level box of an MP4 file
+type mp4Box struct {
+	Type   string
+	Offset int64 // Start of the box header
+	Size   int64 // Including the header
+}
+
+// readTopLevelBoxes lists the top-level boxes of an MP4 file
+func readTopLevelBoxes(file *os.File) ([]mp4Box, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileSize := info.Size()
+
+	var boxes []mp4Box
+	header := make([]byte, 16)
+	for offset := int64(0); offset < fileSize; {
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("failed to read box header at %d: %w", offset, err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+
+		switch size {
+		case 0: // Box extends to the end of the file
+			size = fileSize - offset
+		case 1: // 64-bit size follows the type
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("failed to read %s size at %d: %w", boxType, offset, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > fileSize {
+			return nil, fmt.Errorf("invalid %q box size %d at %d", boxType, size, offset)
+		}
+
+		boxes = append(boxes, mp4Box{Type: boxType, Offset: offset, Size: size})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// NeedsFaststart reports whether the moov box of an MP4 file comes after its media data,
+// which forces players to fetch the end of the file before they can start
+func NeedsFaststart(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	boxes, err := readTopLevelBoxes(file)
+	if err != nil {
+		return false, err
+	}
+
+	seenMdat := false
+	for _, box := range boxes {
+		switch box.Type {
+		case "mdat":
+			seenMdat = true
+		case "moov":
+			return seenMdat, nil
+		}
+	}
+	return false, fmt.Errorf("%w: no moov box", ErrNotFaststartable)
+}
+
+// Faststart writes a copy of src to dst with the moov box moved in front of the media data.
+// Chunk offsets in every stco/co64 table are shifted to match; nothing is re-encoded.
+// Fragmented and compressed-header files are refused with ErrNotFaststartable.
+func Faststart(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	boxes, err := readTopLevelBoxes(in)
+	if err != nil {
+		return err
+	}
+
+	moovIndex, firstMdat := -1, -1
+	for i, box := range boxes {
+		switch box.Type {
+		case "moov":
+			if moovIndex >= 0 {
+				return fmt.Errorf("%w: more than one moov box", ErrNotFaststartable)
+			}
+			moovIndex = i
+		case "mdat":
+			if firstMdat < 0 {
+				firstMdat = i
+			}
+		case "moof":
+			return fmt.Errorf("%w: fragmented mp4", ErrNotFaststartable)
+		}
+	}
+	if moovIndex < 0 || firstMdat < 0 {
+		return fmt.Errorf("%w: missing moov or mdat", ErrNotFaststartable)
+	}
+	if moovIndex < firstMdat {
+		return fmt.Errorf("%w: moov already precedes mdat", ErrNotFaststartable)
+	}
+	moovBox := boxes[moovIndex]
+	if moovBox.Size > maxMoovSize {
+		return fmt.Errorf("%w: moov box is %d bytes", ErrNotFaststartable, moovBox.Size)
+	}
+
+	// New order: everything before the first mdat, moov, then the rest without moov
+	order := make([]mp4Box, 0, len(boxes))
+	order = append(order, boxes[:firstMdat]...)
+	order = append(order, moovBox)
+	for i, box := range boxes[firstMdat:] {
+		if firstMdat+i != moovIndex {
+			order = append(order, box)
+		}
+	}
+
+	// How far each original box moves
+	shifts := make(map[int64]int64, len(order))
+	position := int64(0)
+	for _, box := range order {
+		shifts[box.Offset] = position - box.Offset
+		position += box.Size
+	}
+
+	moov := make([]byte, moovBox.Size)
+	if _, err := in.ReadAt(moov, moovBox.Offset); err != nil {
+		return fmt.Errorf("failed to read moov: %w", err)
+	}
+	relocate := func(offset uint64) (uint64, error) {
+		for _, box := range boxes {
+			if int64(offset) >= box.Offset && int64(offset) < box.Offset+box.Size {
+				return uint64(int64(offset) + shifts[box.Offset]), nil
+			}
+		}
+		return 0, fmt.Errorf("chunk offset %d points outside the file", offset)
+	}
+	if err := patchChunkOffsets(moov, relocate); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for _, box := range order {
+		if box.Offset == moovBox.Offset {
+			_, err = out.Write(moov)
+		} else {
+			_, err = io.Copy(out, io.NewSectionReader(in, box.Offset, box.Size))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s box: %w", box.Type, err)
+		}
+	}
+	return out.Close()
+}
+
+// mp4ContainerBoxes are the boxes on the path from moov to the chunk offset tables
+var mp4ContainerBoxes = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true}
+
+// patchChunkOffsets rewrites every stco/co64 entry inside a moov box in place
+func patchChunkOffsets(moov []byte, relocate func(uint64) (uint64, error)) error {
+	return walkBoxes(moov, func(boxType string, body []byte) error {
+		switch boxType {
+		case "cmov":
+			return fmt.Errorf("%w: compressed moov", ErrNotFaststartable)
+		case "stco", "co64":
+			return patchOffsetTable(boxType, body, relocate)
+		}
+		return nil
+	})
+}
+
+// walkBoxes calls fn for every box in data, descending into container boxes
+func walkBoxes(data []byte, fn func(boxType string, body []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fmt.Errorf("truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		boxType := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return fmt.Errorf("truncated %s header", boxType)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return fmt.Errorf("invalid %q box size %d", boxType, size)
+		}
+
+		body := data[headerSize:size]
+		if err := fn(boxType, body); err != nil {
+			return err
+		}
+		if mp4ContainerBoxes[boxType] {
+			if err := walkBoxes(body, fn); err != nil {
+				return err
+			}
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// patchOffsetTable relocates the entries of an stco (32-bit) or co64 (64-bit) full box body
+func patchOffsetTable(boxType string, body []byte, relocate func(uint64) (uint64, error)) error {
+	if len(body) < 8 {
+		return fmt.Errorf("truncated %s box", boxType)
+	}
+	count := uint64(binary.BigEndian.Uint32(body[4:8]))
+	entries := body[8:]
+
+	entrySize := uint64(4)
+	if boxType == "co64" {
+		entrySize = 8
+	}
+	if count*entrySize > uint64(len(entries)) {
+		return fmt.Errorf("%s declares %d entries but holds %d bytes", boxType, count, len(entries))
+	}
+
+	for i := uint64(0); i < count; i++ {
+		entry := entries[i*entrySize : (i+1)*entrySize]
+		if entrySize == 8 {
+			offset, err := relocate(binary.BigEndian.Uint64(entry))
+			if err != nil {
+				return err
+			}
+			binary.BigEndian.PutUint64(entry, offset)
+			continue
+		}
+
+		offset, err := relocate(uint64(binary.BigEndian.Uint32(entry)))
+		if err != nil {
+			return err
+		}
+		// Growing stco into co64 would change the moov size again; leave such files alone
+		if offset > math.MaxUint32 {
+			return fmt.Errorf("%w: chunk offset %d overflows stco", ErrNotFaststartable, offset)
+		}
+		binary.BigEndian.PutUint32(entry, uint32(offset))
+	}
+	return nil
+}
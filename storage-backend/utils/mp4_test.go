@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// box builds an MP4 box with a 32-bit size
+func box(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(out, uint32(8+len(body)))
+	copy(out[4:], boxType)
+	return append(out, body...)
+}
+
+// largeBox builds an MP4 box with a 64-bit size (size field 1)
+func largeBox(boxType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := make([]byte, 16, 16+len(body))
+	binary.BigEndian.PutUint32(out, 1)
+	copy(out[4:], boxType)
+	binary.BigEndian.PutUint64(out[8:], uint64(16+len(body)))
+	return append(out, body...)
+}
+
+// stco builds a chunk offset table with 32-bit entries
+func stco(offsets ...uint64) []byte {
+	body := make([]byte, 8, 8+4*len(offsets))
+	binary.BigEndian.PutUint32(body[4:], uint32(len(offsets)))
+	for _, offset := range offsets {
+		entry := make([]byte, 4)
+		binary.BigEndian.PutUint32(entry, uint32(offset))
+		body = append(body, entry...)
+	}
+	return box("stco", body)
+}
+
+// co64 builds a chunk offset table with 64-bit entries
+func co64(offsets ...uint64) []byte {
+	body := make([]byte, 8, 8+8*len(offsets))
+	binary.BigEndian.PutUint32(body[4:], uint32(len(offsets)))
+	for _, offset := range offsets {
+		entry := make([]byte, 8)
+		binary.BigEndian.PutUint64(entry, offset)
+		body = append(body, entry...)
+	}
+	return box("co64", body)
+}
+
+// moovWith wraps a chunk offset table in the moov/trak/mdia/minf/stbl path Faststart walks
+func moovWith(table []byte) []byte {
+	return box("moov", box("mvhd", make([]byte, 12)), box("trak", box("mdia", box("minf", box("stbl", table)))))
+}
+
+var ftyp = box("ftyp", []byte("isom"), make([]byte, 4), []byte("isomiso2"))
+
+// samples are the chunks stored in mdat; each starts with a marker the test finds them by
+var samples = [][]byte{[]byte("chunk-one..."), []byte("chunk-two..."), []byte("chunk-three.")}
+
+// moovAtEnd lays out ftyp, mdat and a moov whose chunk offsets point at samples in mdat.
+// table builds the stco or co64 box, mdat the media data box.
+func moovAtEnd(table func(...uint64) []byte, mdat func(string, ...[]byte) []byte) []byte {
+	mdatBox := mdat("mdat", samples...)
+	headerSize := len(mdatBox) - len(bytes.Join(samples, nil))
+	var offsets []uint64
+	position := uint64(len(ftyp) + headerSize)
+	for _, sample := range samples {
+		offsets = append(offsets, position)
+		position += uint64(len(sample))
+	}
+	return bytes.Join([][]byte{ftyp, mdatBox, moovWith(table(offsets...))}, nil)
+}
+
+// chunkOffsets returns the entries of every stco/co64 table in an MP4 file
+func chunkOffsets(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	var offsets []uint64
+	err := walkBoxes(data, func(boxType string, body []byte) error {
+		if boxType == "moov" {
+			return walkBoxes(body, func(boxType string, body []byte) error {
+				switch boxType {
+				case "stco":
+					for i := 0; i < int(binary.BigEndian.Uint32(body[4:8])); i++ {
+						offsets = append(offsets, uint64(binary.BigEndian.Uint32(body[8+4*i:])))
+					}
+				case "co64":
+					for i := 0; i < int(binary.BigEndian.Uint32(body[4:8])); i++ {
+						offsets = append(offsets, binary.BigEndian.Uint64(body[8+8*i:]))
+					}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking output: %v", err)
+	}
+	return offsets
+}
+
+func topLevelTypes(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	boxes, err := readTopLevelBoxes(file)
+	if err != nil {
+		t.Fatalf("reading output boxes: %v", err)
+	}
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.Type)
+	}
+	return types
+}
+
+func TestFaststart(t *testing.T) {
+	cases := []struct {
+		name      string
+		input     []byte
+		needsMove bool  // Expected NeedsFaststart result, when it succeeds
+		needsErr  bool  // NeedsFaststart fails
+		err       error // Expected Faststart error: nil, ErrNotFaststartable or errAny
+	}{
+		{"moov at end with stco", moovAtEnd(stco, box), true, false, nil},
+		{"moov at end with co64", moovAtEnd(co64, box), true, false, nil},
+		{"64-bit mdat size", moovAtEnd(co64, largeBox), true, false, nil},
+		{"already faststart", bytes.Join([][]byte{ftyp, moovWith(stco(100)), box("mdat", samples...)}, nil), false, false, ErrNotFaststartable},
+		{"fragmented", bytes.Join([][]byte{ftyp, box("mdat", samples...), moovWith(stco()), box("moof", box("mfhd", make([]byte, 8))), box("mdat", samples...)}, nil), true, false, ErrNotFaststartable},
+		{"compressed moov", bytes.Join([][]byte{ftyp, box("mdat", samples...), box("moov", box("cmov", make([]byte, 16)))}, nil), true, false, ErrNotFaststartable},
+		{"no moov", bytes.Join([][]byte{ftyp, box("mdat", samples...)}, nil), false, true, ErrNotFaststartable},
+		{"offset outside the file", bytes.Join([][]byte{ftyp, box("mdat", samples...), moovWith(stco(1 << 30))}, nil), true, false, errAny},
+		{"truncated top-level box", moovAtEnd(stco, box)[:len(moovAtEnd(stco, box))-3], false, true, errAny},
+		{"truncated stco", bytes.Join([][]byte{ftyp, box("mdat", samples...), moovWith(box("stco", []byte{0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 1}))}, nil), true, false, errAny},
+	}
+
+	dir := t.TempDir()
+	for _, tc := range cases {
+		src := filepath.Join(dir, "in.mp4")
+		dst := filepath.Join(dir, "out.mp4")
+		if err := os.WriteFile(src, tc.input, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		needs, err := NeedsFaststart(src)
+		if (err != nil) != tc.needsErr {
+			t.Errorf("%s: NeedsFaststart error = %v, want error %v", tc.name, err, tc.needsErr)
+		} else if err == nil && needs != tc.needsMove {
+			t.Errorf("%s: NeedsFaststart = %v, want %v", tc.name, needs, tc.needsMove)
+		}
+
+		err = Faststart(src, dst)
+		switch {
+		case tc.err == nil && err != nil:
+			t.Errorf("%s: Faststart failed: %v", tc.name, err)
+			continue
+		case tc.err == errAny && err == nil, tc.err == ErrNotFaststartable && !errors.Is(err, ErrNotFaststartable):
+			t.Errorf("%s: Faststart error = %v, want %v", tc.name, err, tc.err)
+			continue
+		case tc.err != nil:
+			continue
+		}
+
+		out, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != len(tc.input) {
+			t.Errorf("%s: output is %d bytes, input %d", tc.name, len(out), len(tc.input))
+		}
+		if types := topLevelTypes(t, dst); len(types) != 3 || types[0] != "ftyp" || types[1] != "moov" || types[2] != "mdat" {
+			t.Errorf("%s: output boxes = %v, want [ftyp moov mdat]", tc.name, types)
+		}
+		offsets := chunkOffsets(t, out)
+		if len(offsets) != len(samples) {
+			t.Fatalf("%s: output has %d chunk offsets, want %d", tc.name, len(offsets), len(samples))
+		}
+		// Every shifted offset still points at the chunk it pointed at before
+		for i, offset := range offsets {
+			if end := offset + uint64(len(samples[i])); end > uint64(len(out)) || !bytes.Equal(out[offset:end], samples[i]) {
+				t.Errorf("%s: chunk %d offset %d does not point at %q", tc.name, i, offset, samples[i])
+			}
+		}
+	}
+}
+
+// errAny marks cases that must fail without a specific error
+var errAny = errors.New("any error")
+
+// TestFaststartNoPanic feeds truncated and corrupted files to Faststart; each must fail or succeed, never panic
+func TestFaststartNoPanic(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.mp4")
+	dst := filepath.Join(dir, "out.mp4")
+
+	run := func(name string, data []byte) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Errorf("%s: panic: %v", name, r)
+			}
+		}()
+		if err := os.WriteFile(src, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		NeedsFaststart(src)
+		Faststart(src, dst)
+	}
+
+	for _, valid := range [][]byte{moovAtEnd(stco, box), moovAtEnd(co64, largeBox)} {
+		for n := 0; n < len(valid); n++ {
+			run("truncated", valid[:n])
+		}
+		// Corrupt every byte in turn with values that hit size and count edge cases
+		for i := range valid {
+			for _, value := range []byte{0x00, 0x01, 0x7f, 0xff} {
+				corrupt := append([]byte(nil), valid...)
+				corrupt[i] = value
+				run("corrupted", corrupt)
+			}
+		}
+	}
+}
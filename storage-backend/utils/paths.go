@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxFilenameBytes is the longest stored filename, the common filesystem limit
+const MaxFilenameBytes = 255
+
+var (
+	// ErrPathEscapesRoot is returned when a joined path would resolve outside its root
+	ErrPathEscapesRoot = errors.New("path escapes storage root")
+	// ErrInvalidFilename is returned when nothing usable is left after sanitizing a filename
+	ErrInvalidFilename = errors.New("invalid filename")
+)
+
+// uuidPattern is the default ID format: lesson and material IDs are UUIDs
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+var (
+	idPatternsMu sync.RWMutex
+	idPatterns   = map[string]*regexp.Regexp{}
+)
+
+// CompileIDPattern compiles an ID pattern, anchoring it to the whole ID.
+// An empty pattern means UUIDs.
+func CompileIDPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return uuidPattern, nil
+	}
+
+	idPatternsMu.RLock()
+	re, ok := idPatterns[pattern]
+	idPatternsMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID pattern %q: %w", pattern, err)
+	}
+
+	idPatternsMu.Lock()
+	idPatterns[pattern] = re
+	idPatternsMu.Unlock()
+	return re, nil
+}
+
+// ValidID reports whether id matches pattern (see CompileIDPattern) and is
+// safe to use as a single path segment regardless of what the pattern allows.
+func ValidID(id, pattern string) bool {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, "/\\\x00") {
+		return false
+	}
+	re, err := CompileIDPattern(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(id)
+}
+
+// windowsReserved are device names that cannot be used as filenames on Windows,
+// with or without an extension. Downloads keep the stored name, so avoid them.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFilename turns a client-supplied filename into a safe single path segment:
+// directories are stripped, the name is NFC-normalized, control and reserved
+// characters are replaced, leading/trailing dots and spaces are trimmed, Windows
+// device names are prefixed and the result is capped at MaxFilenameBytes
+// keeping the extension.
+func SanitizeFilename(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", ErrInvalidFilename
+	}
+
+	// Browsers on Windows may send full paths; keep only the last element
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = norm.NFC.String(name)
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case unicode.IsControl(r), r == unicode.ReplacementChar:
+			continue
+		case strings.ContainsRune(`<>:"|?*`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name = strings.Trim(b.String(), " .")
+	if name == "" {
+		return "", ErrInvalidFilename
+	}
+
+	stem := name
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		stem = name[:i]
+	}
+	if windowsReserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = "_" + name
+	}
+
+	return truncateFilename(name, MaxFilenameBytes), nil
+}
+
+// truncateFilename shortens name to at most max bytes on a rune boundary,
+// cutting the stem and keeping a reasonably short extension intact
+func truncateFilename(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > 16 || len(ext) >= max {
+		ext = ""
+	}
+	stem := name[:len(name)-len(ext)]
+
+	limit := max - len(ext)
+	for limit > 0 && !utf8.RuneStart(stem[limit]) {
+		limit--
+	}
+	return strings.TrimRight(stem[:limit], " .") + ext
+}
+
+// SafeJoin joins elems onto root and returns an error if the result, or any
+// existing symlink along it, resolves outside root. Each element is joined as
+// given, so absolute or "../" elements that stay under root are still allowed.
+func SafeJoin(root string, elems ...string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	joined := filepath.Join(append([]string{absRoot}, elems...)...)
+	if !within(absRoot, joined) {
+		return "", fmt.Errorf("%w: %s", ErrPathEscapesRoot, filepath.Join(elems...))
+	}
+
+	// Symlinks inside the tree could still point elsewhere: resolve the
+	// deepest existing ancestor and check it against the resolved root
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return joined, nil
+		}
+		return "", err
+	}
+
+	existing := joined
+	for existing != absRoot {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+
+	realExisting, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if !within(realRoot, realExisting) {
+		return "", fmt.Errorf("%w: %s", ErrPathEscapesRoot, filepath.Join(elems...))
+	}
+
+	return joined, nil
+}
+
+// within reports whether path is root or lies below it; both must be clean and absolute
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidID(t *testing.T) {
+	cases := []struct {
+		id      string
+		pattern string
+		want    bool
+	}{
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c3301", "", true},
+		{"3F2504E0-4F89-11D3-9A0C-0305E82C3301", "", true},
+		{"", "", false},
+		{"..", "", false},
+		{"../3f2504e0-4f89-11d3-9a0c-0305e82c3301", "", false},
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c3301/..", "", false},
+		{"lesson-1", "", false},
+		{"12345", `[0-9]+`, true},
+		{"12345x", `[0-9]+`, false}, // pattern is anchored
+		{"x12345", `[0-9]+`, false}, // pattern is anchored
+		{"..", `.*`, false},         // never a traversal segment, whatever the pattern
+		{"a/b", `.*`, false},        // never multiple segments
+		{`a\b`, `.*`, false},        // nor Windows separators
+		{"a\x00b", `.*`, false},     // nor NUL bytes
+		{"anything", `(`, false},    // invalid patterns reject everything
+	}
+
+	for _, tc := range cases {
+		if got := ValidID(tc.id, tc.pattern); got != tc.want {
+			t.Errorf("ValidID(%q, %q) = %v, want %v", tc.id, tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestCompileIDPattern(t *testing.T) {
+	if _, err := CompileIDPattern("("); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if re, err := CompileIDPattern(""); err != nil || re != uuidPattern {
+		t.Errorf("empty pattern should select the UUID pattern, got %v, %v", re, err)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{"/etc/passwd", "passwd"},
+		{`C:\Users\me\slides.pptx`, "slides.pptx"},
+		{"..\\..\\boot.ini", "boot.ini"},
+		{"bad\x00name\x1f.txt", "badname.txt"},
+		{`what?<is>"this"|*.doc`, "what__is__this___.doc"},
+		{"  .hidden. ", "hidden"},
+		{"tab\tname.txt", "tab name.txt"},
+		{"CON", "_CON"},
+		{"con.txt", "_con.txt"},
+		{"LPT1.tar.gz", "_LPT1.tar.gz"},
+		{"CONSOLE.txt", "CONSOLE.txt"},
+		{"cafe\u0301.txt", "caf\u00e9.txt"}, // NFD input is stored as NFC
+		{"bài giảng.pdf", "bài giảng.pdf"},
+	}
+
+	for _, tc := range cases {
+		got, err := SanitizeFilename(tc.name)
+		if err != nil {
+			t.Errorf("SanitizeFilename(%q) returned error %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeFilenameRejects(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "../", "dir/", " . ", "\x00", "\xff\xfe.txt"} {
+		if got, err := SanitizeFilename(name); !errors.Is(err, ErrInvalidFilename) {
+			t.Errorf("SanitizeFilename(%q) = %q, %v, want ErrInvalidFilename", name, got, err)
+		}
+	}
+}
+
+func TestSanitizeFilenameLength(t *testing.T) {
+	long := strings.Repeat("á", 300) + ".pdf"
+
+	got, err := SanitizeFilename(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) > MaxFilenameBytes {
+		t.Errorf("sanitized name is %d bytes, want at most %d", len(got), MaxFilenameBytes)
+	}
+	if !strings.HasSuffix(got, ".pdf") {
+		t.Errorf("extension was not preserved: %q", got)
+	}
+	if !strings.HasPrefix(got, "á") || strings.ContainsRune(got, '\uFFFD') {
+		t.Errorf("truncation split a rune: %q", got)
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	root := t.TempDir()
+
+	allowed := [][]string{
+		{"lesson", "video.mp4"},
+		{"lesson", "material", "notes.pdf"},
+		{"lesson", "..", "other"}, // stays under root
+		{"/lesson"},               // absolute elements are joined, not used as-is
+	}
+	for _, elems := range allowed {
+		got, err := SafeJoin(root, elems...)
+		if err != nil {
+			t.Errorf("SafeJoin(%v) returned error %v", elems, err)
+			continue
+		}
+		if !strings.HasPrefix(got, root+string(filepath.Separator)) {
+			t.Errorf("SafeJoin(%v) = %q, not under %q", elems, got, root)
+		}
+	}
+
+	blocked := [][]string{
+		{".."},
+		{"..", "etc", "passwd"},
+		{"lesson", "..", "..", "escape"},
+		{"lesson/../../escape"},
+	}
+	for _, elems := range blocked {
+		if got, err := SafeJoin(root, elems...); !errors.Is(err, ErrPathEscapesRoot) {
+			t.Errorf("SafeJoin(%v) = %q, %v, want ErrPathEscapesRoot", elems, got, err)
+		}
+	}
+}
+
+func TestSafeJoinSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	for _, elems := range [][]string{{"link"}, {"link", "file.txt"}, {"link", "new", "dir"}} {
+		if got, err := SafeJoin(root, elems...); !errors.Is(err, ErrPathEscapesRoot) {
+			t.Errorf("SafeJoin(%v) = %q, %v, want ErrPathEscapesRoot", elems, got, err)
+		}
+	}
+
+	// A symlink that stays inside the root is fine
+	if err := os.Mkdir(filepath.Join(root, "real"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "real"), filepath.Join(root, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SafeJoin(root, "alias", "file.txt"); err != nil {
+		t.Errorf("SafeJoin through an internal symlink returned %v", err)
+	}
+}